@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// streetDirectionals maps directional abbreviations to their full form
+var streetDirectionals = map[string]string{
+	"N": "North", "NORTH": "North",
+	"S": "South", "SOUTH": "South",
+	"E": "East", "EAST": "East",
+	"W": "West", "WEST": "West",
+}
+
+// streetSuffixes maps street suffixes and their USPS-style abbreviations to
+// one canonical spelling
+var streetSuffixes = map[string]string{
+	"ST": "Street", "STR": "Street", "STREET": "Street",
+	"AVE": "Avenue", "AV": "Avenue", "AVEN": "Avenue", "AVENUE": "Avenue",
+	"BLVD": "Boulevard", "BOULEVARD": "Boulevard",
+	"PL": "Place", "PLACE": "Place",
+	"RD": "Road", "ROAD": "Road",
+	"DR": "Drive", "DRIVE": "Drive",
+	"PKWY": "Parkway", "PKY": "Parkway", "PARKWAY": "Parkway",
+	"LN": "Lane", "LANE": "Lane",
+	"CT": "Court", "COURT": "Court",
+	"TER": "Terrace", "TERR": "Terrace", "TERRACE": "Terrace",
+	"SQ": "Square", "SQUARE": "Square",
+	"PLZ": "Plaza", "PLAZA": "Plaza",
+	"HWY": "Highway", "HIGHWAY": "Highway",
+	"EXPY": "Expressway", "EXPRESSWAY": "Expressway",
+	"CIR": "Circle", "CIRCLE": "Circle",
+	"ALY": "Alley", "ALLEY": "Alley",
+	"WAY":  "Way",
+	"LOOP": "Loop",
+	"WALK": "Walk",
+	"ROW":  "Row",
+	"SLIP": "Slip",
+}
+
+// streetNameAliases are whole-word spellings of well-known street names
+var streetNameAliases = map[string]string{
+	"BWAY": "Broadway",
+	"BDWY": "Broadway",
+	"FT":   "Fort",
+	"MT":   "Mount",
+}
+
+// ordinalWords maps spelled-out ordinals to their numbers
+var ordinalWords = map[string]int{
+	"FIRST": 1, "SECOND": 2, "THIRD": 3, "FOURTH": 4, "FIFTH": 5,
+	"SIXTH": 6, "SEVENTH": 7, "EIGHTH": 8, "NINTH": 9, "TENTH": 10,
+	"ELEVENTH": 11, "TWELFTH": 12, "THIRTEENTH": 13, "FOURTEENTH": 14,
+	"FIFTEENTH": 15, "SIXTEENTH": 16, "SEVENTEENTH": 17, "EIGHTEENTH": 18,
+	"NINETEENTH": 19, "TWENTIETH": 20,
+}
+
+var (
+	// houseNumberPattern matches "123", "123A" and Queens-style "37-12"
+	houseNumberPattern = regexp.MustCompile(`^\d+[A-Z]?(-\d+[A-Z]?)?$`)
+	ordinalPattern     = regexp.MustCompile(`^(\d+)(ST|ND|RD|TH)?$`)
+	unitFloorPattern   = regexp.MustCompile(`^(\d+)(?:ST|ND|RD|TH)?(?:FL|FLR|FLOOR)$`)
+	unitNumberPattern  = regexp.MustCompile(`^(\d+)([A-Z]*)$`)
+)
+
+// NormalizeStreet canonicalizes an NYC street address so that spellings
+// like "123 N 7th St." and "123 North Seventh Street", or "100 Park Ave S"
+// and "100 Park Avenue South", compare equal. It expands directionals and
+// suffixes, writes ordinals as "7th", and title-cases the rest. Text it
+// can't parse is returned tidied but otherwise unchanged.
+func NormalizeStreet(street string) string {
+	tokens := addressTokens(street)
+	if len(tokens) == 0 {
+		return ""
+	}
+
+	var words []string
+	if houseNumberPattern.MatchString(tokens[0]) && len(tokens) > 1 {
+		words = append(words, tokens[0])
+		tokens = tokens[1:]
+	}
+
+	for i, token := range tokens {
+		first, last := i == 0, i == len(tokens)-1
+		switch {
+		case trailingDirectional(tokens, i):
+			words = append(words, streetDirectionals[token])
+		case !first && streetSuffixes[token] != "" && (last || trailingDirectional(tokens, i+1)):
+			words = append(words, streetSuffixes[token])
+		case token == "ST" && !last:
+			// "St Marks Pl": St before the name is Saint
+			words = append(words, "Saint")
+		case first && !last && streetDirectionals[token] != "":
+			words = append(words, streetDirectionals[token])
+		case streetNameAliases[token] != "":
+			words = append(words, streetNameAliases[token])
+		case ordinalWords[token] > 0:
+			words = append(words, ordinal(ordinalWords[token]))
+		case ordinalPattern.MatchString(token) && isNumberedStreet(tokens, i):
+			n, _ := strconv.Atoi(ordinalPattern.FindStringSubmatch(token)[1])
+			words = append(words, ordinal(n))
+		default:
+			words = append(words, titleWord(token))
+		}
+	}
+
+	return strings.Join(words, " ")
+}
+
+// trailingDirectional reports whether tokens[i] is a directional ending a
+// street name, as in "Park Ave S" or "Central Park W". It needs two words
+// before it so Brooklyn's lettered avenues like "Avenue S" are left alone.
+func trailingDirectional(tokens []string, i int) bool {
+	return i >= 2 && i == len(tokens)-1 && streetDirectionals[tokens[i]] != ""
+}
+
+// isNumberedStreet reports whether the number at tokens[i] names a street,
+// as in "W 7 St" or "7th Ave", rather than being part of a name like "Avenue 1"
+func isNumberedStreet(tokens []string, i int) bool {
+	if strings.ContainsAny(tokens[i], "SNRT") {
+		return true // already has an ordinal suffix
+	}
+	return i+1 < len(tokens) && streetSuffixes[tokens[i+1]] != ""
+}
+
+// addressTokens uppercases text, drops punctuation other than hyphens in
+// house numbers, and splits it into words
+func addressTokens(text string) []string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-':
+			b.WriteRune(r)
+		case r == '\'':
+			// "Hell's" stays one word
+		default:
+			b.WriteRune(' ')
+		}
+	}
+
+	var tokens []string
+	for _, token := range strings.Fields(b.String()) {
+		if token = strings.Trim(token, "-"); token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// ordinal writes n with its English ordinal suffix
+func ordinal(n int) string {
+	suffix := "th"
+	if n%100 < 11 || n%100 > 13 {
+		switch n % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return fmt.Sprintf("%d%s", n, suffix)
+}
+
+// titleWord capitalizes the first letter of an uppercase word
+func titleWord(word string) string {
+	if word == "" {
+		return word
+	}
+	return word[:1] + strings.ToLower(word[1:])
+}
+
+// normalizeAddress fills in the parsed street and unit from Street and Unit
+func (l *Listing) normalizeAddress() {
+	l.NormalizedStreet = NormalizeStreet(l.Street)
+	l.UnitInfo = ParseUnit(l.Unit)
+}
+
+// UnitInfo is a unit designation parsed into floor and position
+type UnitInfo struct {
+	// Normalized is the unit with prefixes and punctuation removed, e.g. "4R"
+	Normalized string
+
+	// Floor is the floor number, -1 for a basement, or 0 when unknown
+	Floor int
+
+	// Position is what remains after the floor, e.g. "R" in 4R or "03" in 1203
+	Position string
+
+	Penthouse bool
+	Garden    bool
+}
+
+// unitPrefixes are words that introduce a unit designation
+var unitPrefixes = []string{"APARTMENT", "APT", "UNIT", "NO", "NUMBER"}
+
+// ParseUnit parses a unit string such as "#4R", "4-R", "Unit 4R", "PH2",
+// "1203" or "Garden" into its normalized form, floor and position. Three-
+// and four-digit units are read as floor plus apartment number. A bare one-
+// or two-digit unit like "Apt 2" is just a number, so its floor is unknown.
+func ParseUnit(raw string) UnitInfo {
+	tokens := addressTokens(strings.ReplaceAll(raw, "#", " "))
+	for len(tokens) > 1 && containsString(unitPrefixes, tokens[0]) {
+		tokens = tokens[1:]
+	}
+	if len(tokens) == 1 && containsString(unitPrefixes, tokens[0]) {
+		tokens = nil
+	}
+
+	normalized := strings.ReplaceAll(strings.Join(tokens, ""), "-", "")
+	info := UnitInfo{Normalized: normalized}
+	if normalized == "" {
+		return info
+	}
+
+	switch {
+	case strings.HasPrefix(normalized, "PH") || strings.HasPrefix(normalized, "PENTHOUSE"):
+		info.Penthouse = true
+		info.Position = strings.TrimPrefix(strings.TrimPrefix(normalized, "PENTHOUSE"), "PH")
+		return info
+	case normalized == "GARDEN" || normalized == "GDN" || strings.HasPrefix(normalized, "GARDEN"):
+		info.Garden = true
+		info.Floor = 1
+		info.Position = strings.TrimPrefix(normalized, "GARDEN")
+		return info
+	case normalized == "BSMT" || normalized == "BASEMENT" || normalized == "LL" || normalized == "LOWERLEVEL":
+		info.Floor = -1
+		return info
+	case normalized == "GROUND" || normalized == "GRD" || normalized == "GF":
+		info.Floor = 1
+		return info
+	}
+
+	if m := unitFloorPattern.FindStringSubmatch(normalized); m != nil {
+		info.Floor, _ = strconv.Atoi(m[1])
+		return info
+	}
+
+	if m := unitNumberPattern.FindStringSubmatch(normalized); m != nil {
+		digits, letters := m[1], m[2]
+		switch {
+		case letters == "" && (len(digits) == 3 || len(digits) == 4):
+			// 403 is floor 4, apartment 03; 1203 is floor 12, apartment 03
+			info.Floor, _ = strconv.Atoi(digits[:len(digits)-2])
+			info.Position = digits[len(digits)-2:]
+		case letters != "" && len(digits) <= 2:
+			info.Floor, _ = strconv.Atoi(digits)
+			info.Position = letters
+		}
+		if info.Floor == 0 {
+			info.Position = ""
+		}
+	}
+
+	return info
+}
+
+// FloorLabel describes the floor for display, or "" when unknown
+func (u UnitInfo) FloorLabel() string {
+	switch {
+	case u.Penthouse:
+		return "Penthouse"
+	case u.Garden:
+		return "Garden"
+	case u.Floor < 0:
+		return "Basement"
+	case u.Floor == 0:
+		return ""
+	default:
+		return fmt.Sprintf("%s floor", ordinal(u.Floor))
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+func TestNormalizeStreet(t *testing.T) {
+	tests := []struct {
+		street string
+		want   string
+	}{
+		{"123 N 7th St.", "123 North 7th Street"},
+		{"123 North Seventh Street", "123 North 7th Street"},
+		{"123 n 7 st", "123 North 7th Street"},
+		{"100 Park Ave S", "100 Park Avenue South"},
+		{"100 Park Avenue South", "100 Park Avenue South"},
+		{"1500 Avenue S", "1500 Avenue S"},
+		{"25 St Marks Pl", "25 Saint Marks Place"},
+		{"25 St. Marks Place", "25 Saint Marks Place"},
+		{"37-12 31st Ave", "37-12 31st Avenue"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeStreet(tt.street); got != tt.want {
+			t.Errorf("NormalizeStreet(%q) = %q, want %q", tt.street, got, tt.want)
+		}
+	}
+
+	// Spellings of one address compare equal, and Avenue S stays apart
+	// from Park Ave S
+	if NormalizeStreet("123 N 7th St.") != NormalizeStreet("123 North Seventh Street") {
+		t.Error("123 N 7th St. and 123 North Seventh Street differ")
+	}
+	if NormalizeStreet("100 Park Ave S") == NormalizeStreet("100 Avenue S") {
+		t.Error("Park Ave S and Avenue S normalize the same")
+	}
+}
+
+func TestParseUnit(t *testing.T) {
+	tests := []struct {
+		unit       string
+		normalized string
+		floor      int
+		position   string
+		penthouse  bool
+	}{
+		{"#4R", "4R", 4, "R", false},
+		{"4-R", "4R", 4, "R", false},
+		{"Unit 4R", "4R", 4, "R", false},
+		{"1203", "1203", 12, "03", false},
+		{"Apt 2", "2", 0, "", false},
+		{"PH2", "PH2", 0, "2", true},
+		{"Apt", "", 0, "", false},
+	}
+
+	for _, tt := range tests {
+		got := ParseUnit(tt.unit)
+		if got.Normalized != tt.normalized || got.Floor != tt.floor || got.Position != tt.position || got.Penthouse != tt.penthouse {
+			t.Errorf("ParseUnit(%q) = %+v, want normalized %q, floor %d, position %q, penthouse %v",
+				tt.unit, got, tt.normalized, tt.floor, tt.position, tt.penthouse)
+		}
+	}
+}
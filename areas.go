@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Area is a StreetEasy area: a borough, a group of neighborhoods or a
+// single neighborhood. ParentID is 0 for boroughs.
+type Area struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Borough  string `json:"borough"`
+	ParentID int    `json:"parentId,omitempty"`
+}
+
+// bundledAreas maps StreetEasy area IDs, as used in the area: filter of its
+// search URLs, to names and boroughs. Groups such as North Brooklyn are the
+// parents of their neighborhoods, so searching a group covers everything in it.
+// Only the borough IDs (the round hundreds) are known to be right. The
+// neighborhood IDs are unverified best guesses that haven't been checked
+// against StreetEasy, so check an ID against a search URL before relying on
+// it, and add or correct entries with the config file's areaCatalog section.
+var bundledAreas = []Area{
+	// Manhattan
+	{ID: 100, Name: "Manhattan", Borough: "Manhattan"},
+	{ID: 102, Name: "Downtown Manhattan", Borough: "Manhattan", ParentID: 100},
+	{ID: 103, Name: "Battery Park City", Borough: "Manhattan", ParentID: 102},
+	{ID: 104, Name: "Chelsea", Borough: "Manhattan", ParentID: 102},
+	{ID: 105, Name: "Chinatown", Borough: "Manhattan", ParentID: 102},
+	{ID: 106, Name: "Civic Center", Borough: "Manhattan", ParentID: 102},
+	{ID: 107, Name: "East Village", Borough: "Manhattan", ParentID: 102},
+	{ID: 108, Name: "Financial District", Borough: "Manhattan", ParentID: 102},
+	{ID: 109, Name: "Flatiron", Borough: "Manhattan", ParentID: 102},
+	{ID: 110, Name: "Gramercy Park", Borough: "Manhattan", ParentID: 102},
+	{ID: 111, Name: "Greenwich Village", Borough: "Manhattan", ParentID: 102},
+	{ID: 112, Name: "Little Italy", Borough: "Manhattan", ParentID: 102},
+	{ID: 113, Name: "Lower East Side", Borough: "Manhattan", ParentID: 102},
+	{ID: 114, Name: "Noho", Borough: "Manhattan", ParentID: 102},
+	{ID: 115, Name: "SoHo", Borough: "Manhattan", ParentID: 102},
+	{ID: 116, Name: "Tribeca", Borough: "Manhattan", ParentID: 102},
+	{ID: 117, Name: "West Village", Borough: "Manhattan", ParentID: 102},
+	{ID: 157, Name: "Nolita", Borough: "Manhattan", ParentID: 102},
+	{ID: 158, Name: "Hudson Square", Borough: "Manhattan", ParentID: 102},
+	{ID: 162, Name: "Two Bridges", Borough: "Manhattan", ParentID: 102},
+	{ID: 118, Name: "Midtown", Borough: "Manhattan", ParentID: 100},
+	{ID: 119, Name: "Midtown East", Borough: "Manhattan", ParentID: 118},
+	{ID: 120, Name: "Murray Hill", Borough: "Manhattan", ParentID: 118},
+	{ID: 121, Name: "Kips Bay", Borough: "Manhattan", ParentID: 118},
+	{ID: 122, Name: "Hell's Kitchen", Borough: "Manhattan", ParentID: 118},
+	{ID: 123, Name: "Midtown South", Borough: "Manhattan", ParentID: 118},
+	{ID: 130, Name: "Upper West Side", Borough: "Manhattan", ParentID: 100},
+	{ID: 139, Name: "Upper East Side", Borough: "Manhattan", ParentID: 100},
+	{ID: 140, Name: "Upper Manhattan", Borough: "Manhattan", ParentID: 100},
+	{ID: 141, Name: "Harlem", Borough: "Manhattan", ParentID: 140},
+	{ID: 142, Name: "East Harlem", Borough: "Manhattan", ParentID: 140},
+	{ID: 143, Name: "Washington Heights", Borough: "Manhattan", ParentID: 140},
+	{ID: 144, Name: "Inwood", Borough: "Manhattan", ParentID: 140},
+	{ID: 145, Name: "Hamilton Heights", Borough: "Manhattan", ParentID: 140},
+	{ID: 146, Name: "Morningside Heights", Borough: "Manhattan", ParentID: 140},
+
+	// Bronx
+	{ID: 200, Name: "Bronx", Borough: "Bronx"},
+	{ID: 201, Name: "Mott Haven", Borough: "Bronx", ParentID: 200},
+	{ID: 202, Name: "Riverdale", Borough: "Bronx", ParentID: 200},
+
+	// Brooklyn
+	{ID: 300, Name: "Brooklyn", Borough: "Brooklyn"},
+	{ID: 301, Name: "North Brooklyn", Borough: "Brooklyn", ParentID: 300},
+	{ID: 302, Name: "Williamsburg", Borough: "Brooklyn", ParentID: 301},
+	{ID: 303, Name: "Greenpoint", Borough: "Brooklyn", ParentID: 301},
+	{ID: 304, Name: "Bushwick", Borough: "Brooklyn", ParentID: 301},
+	{ID: 305, Name: "East Williamsburg", Borough: "Brooklyn", ParentID: 301},
+	{ID: 310, Name: "Northwest Brooklyn", Borough: "Brooklyn", ParentID: 300},
+	{ID: 311, Name: "Brooklyn Heights", Borough: "Brooklyn", ParentID: 310},
+	{ID: 312, Name: "DUMBO", Borough: "Brooklyn", ParentID: 310},
+	{ID: 313, Name: "Cobble Hill", Borough: "Brooklyn", ParentID: 310},
+	{ID: 314, Name: "Carroll Gardens", Borough: "Brooklyn", ParentID: 310},
+	{ID: 315, Name: "Boerum Hill", Borough: "Brooklyn", ParentID: 310},
+	{ID: 316, Name: "Fort Greene", Borough: "Brooklyn", ParentID: 310},
+	{ID: 317, Name: "Clinton Hill", Borough: "Brooklyn", ParentID: 310},
+	{ID: 318, Name: "Park Slope", Borough: "Brooklyn", ParentID: 310},
+	{ID: 319, Name: "Prospect Heights", Borough: "Brooklyn", ParentID: 310},
+	{ID: 320, Name: "Downtown Brooklyn", Borough: "Brooklyn", ParentID: 310},
+	{ID: 321, Name: "Gowanus", Borough: "Brooklyn", ParentID: 310},
+	{ID: 322, Name: "Red Hook", Borough: "Brooklyn", ParentID: 310},
+	{ID: 330, Name: "Central Brooklyn", Borough: "Brooklyn", ParentID: 300},
+	{ID: 331, Name: "Bedford-Stuyvesant", Borough: "Brooklyn", ParentID: 330},
+	{ID: 332, Name: "Crown Heights", Borough: "Brooklyn", ParentID: 330},
+	{ID: 333, Name: "Prospect Lefferts Gardens", Borough: "Brooklyn", ParentID: 330},
+	{ID: 334, Name: "Flatbush", Borough: "Brooklyn", ParentID: 330},
+	{ID: 335, Name: "Ditmas Park", Borough: "Brooklyn", ParentID: 330},
+
+	// Queens
+	{ID: 400, Name: "Queens", Borough: "Queens"},
+	{ID: 401, Name: "Astoria", Borough: "Queens", ParentID: 400},
+	{ID: 402, Name: "Long Island City", Borough: "Queens", ParentID: 400},
+	{ID: 403, Name: "Sunnyside", Borough: "Queens", ParentID: 400},
+	{ID: 404, Name: "Ridgewood", Borough: "Queens", ParentID: 400},
+	{ID: 405, Name: "Jackson Heights", Borough: "Queens", ParentID: 400},
+	{ID: 406, Name: "Forest Hills", Borough: "Queens", ParentID: 400},
+
+	// Staten Island
+	{ID: 500, Name: "Staten Island", Borough: "Staten Island"},
+	{ID: 501, Name: "St. George", Borough: "Staten Island", ParentID: 500},
+}
+
+// AreaCatalog looks up StreetEasy areas by ID or name
+type AreaCatalog struct {
+	byID   map[int]Area
+	byName map[string]Area
+}
+
+// NewAreaCatalog builds a catalog from the bundled areas plus any extra
+// entries, which replace bundled entries with the same ID
+func NewAreaCatalog(extra []Area) *AreaCatalog {
+	c := &AreaCatalog{
+		byID:   make(map[int]Area),
+		byName: make(map[string]Area),
+	}
+	for _, area := range bundledAreas {
+		c.add(area)
+	}
+	for _, area := range extra {
+		if old, ok := c.byID[area.ID]; ok {
+			delete(c.byName, normalizeAreaName(old.Name))
+		}
+		c.add(area)
+	}
+	return c
+}
+
+func (c *AreaCatalog) add(area Area) {
+	c.byID[area.ID] = area
+	c.byName[normalizeAreaName(area.Name)] = area
+}
+
+// ByID returns the area with the given ID
+func (c *AreaCatalog) ByID(id int) (Area, bool) {
+	area, ok := c.byID[id]
+	return area, ok
+}
+
+// ByName returns the area with the given name, ignoring case and punctuation
+func (c *AreaCatalog) ByName(name string) (Area, bool) {
+	area, ok := c.byName[normalizeAreaName(name)]
+	return area, ok
+}
+
+// Children returns the direct children of an area, sorted by name
+func (c *AreaCatalog) Children(id int) []Area {
+	var children []Area
+	for _, area := range c.byID {
+		if area.ParentID == id {
+			children = append(children, area)
+		}
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].Name < children[j].Name })
+	return children
+}
+
+// Search returns areas whose name or borough contains the query, sorted by ID
+func (c *AreaCatalog) Search(query string) []Area {
+	q := normalizeAreaName(query)
+	var matches []Area
+	for _, area := range c.byID {
+		if strings.Contains(normalizeAreaName(area.Name), q) || strings.Contains(normalizeAreaName(area.Borough), q) {
+			matches = append(matches, area)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ID < matches[j].ID })
+	return matches
+}
+
+// ResolveNames maps area names to IDs, reporting every unknown name
+func (c *AreaCatalog) ResolveNames(names []string) ([]int, error) {
+	var ids []int
+	var unknown []string
+	for _, name := range names {
+		area, ok := c.ByName(name)
+		if !ok {
+			unknown = append(unknown, fmt.Sprintf("%q", name))
+			continue
+		}
+		ids = append(ids, area.ID)
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown area name(s): %s", strings.Join(unknown, ", "))
+	}
+	return ids, nil
+}
+
+// normalizeAreaName lowercases a name and drops everything but letters and digits
+func normalizeAreaName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
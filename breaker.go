@@ -0,0 +1,98 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	breakerInitialCooldown = 30 * time.Minute
+	breakerMaxCooldown     = 12 * time.Hour
+)
+
+// CircuitBreaker stops requests to a listing source after it blocks us. While
+// open, requests are refused until the cool-down passes; then a single probe
+// is allowed. A failed probe reopens the breaker with a doubled cool-down.
+type CircuitBreaker struct {
+	mu          sync.Mutex
+	open        bool
+	probing     bool
+	openedAt    time.Time
+	until       time.Time
+	cooldown    time.Duration
+	maxCooldown time.Duration
+	initial     time.Duration
+}
+
+// NewCircuitBreaker creates a closed circuit breaker
+func NewCircuitBreaker() *CircuitBreaker {
+	return &CircuitBreaker{
+		initial:     breakerInitialCooldown,
+		maxCooldown: breakerMaxCooldown,
+	}
+}
+
+// Allow reports whether a request may be made now. When the cool-down has
+// passed it allows a probe and returns probe=true.
+func (b *CircuitBreaker) Allow() (allowed, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.open {
+		return true, false
+	}
+	if time.Now().Before(b.until) {
+		return false, false
+	}
+	b.probing = true
+	return true, true
+}
+
+// RecordBlocked notes a block response. It returns opened=true only when the
+// breaker goes from closed to open, so callers alert once per incident.
+func (b *CircuitBreaker) RecordBlocked() (opened bool, cooldown time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.open {
+		b.open = true
+		b.openedAt = time.Now()
+		b.cooldown = b.initial
+		opened = true
+	} else if b.probing {
+		b.cooldown *= 2
+		if b.cooldown > b.maxCooldown {
+			b.cooldown = b.maxCooldown
+		}
+	}
+	b.probing = false
+	b.until = time.Now().Add(b.cooldown)
+	return opened, b.cooldown
+}
+
+// RecordSuccess notes a successful request. It returns recovered=true when
+// this closes an open breaker, along with how long we were blocked.
+func (b *CircuitBreaker) RecordSuccess() (recovered bool, blockedFor time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.open {
+		return false, 0
+	}
+	blockedFor = time.Since(b.openedAt)
+	b.open = false
+	b.probing = false
+	b.cooldown = 0
+	return true, blockedFor
+}
+
+// OpenUntil returns when the breaker will next allow a probe, or zero if closed
+func (b *CircuitBreaker) OpenUntil() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.open {
+		return time.Time{}
+	}
+	return b.until
+}
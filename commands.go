@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// runAreasCommand prints the area catalog, or the areas matching a query
+func runAreasCommand(args []string) int {
+	var extra []Area
+	if path := os.Getenv("CONFIG_PATH"); path != "" {
+		fc, err := loadFileConfig(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+			return 1
+		}
+		extra = fc.AreaCatalog
+	}
+	catalog := NewAreaCatalog(extra)
+
+	if len(args) > 0 {
+		query := strings.Join(args, " ")
+		matches := catalog.Search(query)
+		if len(matches) == 0 {
+			fmt.Printf("No areas match %q\n", query)
+			return 1
+		}
+		for _, area := range matches {
+			parent := area.Borough
+			if p, ok := catalog.ByID(area.ParentID); ok {
+				parent = p.Name
+			}
+			fmt.Printf("%5d  %-28s %s\n", area.ID, area.Name, parent)
+		}
+		return 0
+	}
+
+	for _, borough := range catalog.Children(0) {
+		printAreaTree(catalog, borough, 0)
+	}
+	return 0
+}
+
+// printAreaTree prints an area and its descendants, indented by depth
+func printAreaTree(catalog *AreaCatalog, area Area, depth int) {
+	fmt.Printf("%5d  %s%s\n", area.ID, strings.Repeat("  ", depth), area.Name)
+	for _, child := range catalog.Children(area.ID) {
+		printAreaTree(catalog, child, depth+1)
+	}
+}
+
+// runValidateCommand checks the configuration and reports every problem.
+// With -live it also fetches each Discord webhook to confirm it exists.
+func runValidateCommand(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	live := flags.Bool("live", false, "also confirm each Discord webhook exists")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		problems := flattenErrors(err)
+		fmt.Printf("Config has %d problem(s):\n", len(problems))
+		for _, problem := range problems {
+			fmt.Printf("  - %v\n", problem)
+		}
+		return 1
+	}
+
+	// The bundled catalog is unverified, so an ID missing from it may still
+	// be a real StreetEasy area
+	if unknown := cfg.UnknownAreaIDs(); len(unknown) > 0 {
+		fmt.Printf("Warning: %d area ID(s) aren't in the area catalog; check them against a StreetEasy search URL:\n", len(unknown))
+		for _, warning := range unknown {
+			fmt.Printf("  - %v\n", warning)
+		}
+	}
+
+	var problems []error
+	if *live {
+		discordClient := NewDiscordClient(nil, "", "")
+		for _, webhook := range cfg.webhookLabels() {
+			if err := discordClient.CheckWebhook(context.Background(), webhook.url); err != nil {
+				problems = append(problems, fmt.Errorf("%s: %w", webhook.label, err))
+			}
+			// Stay well under Discord's rate limit
+			time.Sleep(500 * time.Millisecond)
+		}
+	}
+
+	if len(problems) > 0 {
+		fmt.Printf("Config has %d problem(s):\n", len(problems))
+		for _, problem := range problems {
+			fmt.Printf("  - %v\n", problem)
+		}
+		return 1
+	}
+
+	fmt.Printf("Config OK: %d search(es), %d route(s)\n", len(cfg.Searches), len(cfg.Routes))
+	return 0
+}
+
+// flattenErrors expands errors built with errors.Join into their parts
+func flattenErrors(err error) []error {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{err}
+	}
+	var flat []error
+	for _, e := range joined.Unwrap() {
+		flat = append(flat, flattenErrors(e)...)
+	}
+	return flat
+}
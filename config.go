@@ -1,23 +1,56 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
+// defaultShutdownGracePeriod is how long shutdown waits for a running poll
+const defaultShutdownGracePeriod = 30 * time.Second
+
 // Config holds the application configuration
 type Config struct {
 	DiscordWebhookURL       string
 	DiscordErrorWebhookURL  string
 	DiscordStatusWebhookURL string
 	DatabasePath            string
+	ConfigPath              string
+	ConfigReloadInterval    time.Duration
+	ShutdownGracePeriod     time.Duration
+	Searches                []Search
+	Routes                  []Route
+	Schedule                Schedule
+	Areas                   *AreaCatalog
+	StreetEasyProxies       []*url.URL
+	HeaderProfiles          []headerProfile
+	Duplicates              DuplicateMode
+	PriceDrop               PriceDropThreshold
+	OffMarketAfter          int
+}
+
+// fileConfig is the layout of the optional JSON config file
+type fileConfig struct {
+	Searches    []Search  `json:"searches"`
+	Routes      []Route   `json:"routes"`
+	Schedule    *Schedule `json:"schedule"`
+	AreaCatalog []Area    `json:"areaCatalog"`
 }
 
-// LoadConfig loads configuration from environment variables
+// LoadConfig loads configuration from environment variables and the
+// optional config file. Validation problems are reported together.
 func LoadConfig() (*Config, error) {
+	var problems []error
+
 	webhookURL := os.Getenv("DISCORD_WEBHOOK_URL")
 	if webhookURL == "" {
-		return nil, errors.New("DISCORD_WEBHOOK_URL environment variable is required")
+		problems = append(problems, errors.New("DISCORD_WEBHOOK_URL environment variable is required"))
 	}
 
 	dbPath := os.Getenv("DATABASE_PATH")
@@ -28,10 +61,302 @@ func LoadConfig() (*Config, error) {
 	errorWebhookURL := os.Getenv("DISCORD_ERROR_WEBHOOK_URL")
 	statusWebhookURL := os.Getenv("DISCORD_STATUS_WEBHOOK_URL")
 
-	return &Config{
+	cfg := &Config{
 		DiscordWebhookURL:       webhookURL,
 		DiscordErrorWebhookURL:  errorWebhookURL,
 		DiscordStatusWebhookURL: statusWebhookURL,
 		DatabasePath:            dbPath,
-	}, nil
+		ShutdownGracePeriod:     defaultShutdownGracePeriod,
+		ConfigPath:              os.Getenv("CONFIG_PATH"),
+		Searches:                DefaultSearches(),
+		Areas:                   NewAreaCatalog(nil),
+	}
+
+	if interval := os.Getenv("CONFIG_RELOAD_INTERVAL"); interval != "" {
+		parsed, err := time.ParseDuration(interval)
+		if err != nil || parsed <= 0 {
+			problems = append(problems, fmt.Errorf("invalid CONFIG_RELOAD_INTERVAL %q", interval))
+		}
+		cfg.ConfigReloadInterval = parsed
+	}
+
+	if grace := os.Getenv("SHUTDOWN_GRACE_PERIOD"); grace != "" {
+		parsed, err := time.ParseDuration(grace)
+		if err != nil || parsed < 0 {
+			problems = append(problems, fmt.Errorf("invalid SHUTDOWN_GRACE_PERIOD %q", grace))
+		}
+		cfg.ShutdownGracePeriod = parsed
+	}
+
+	for _, raw := range splitList(os.Getenv("STREETEASY_PROXIES")) {
+		proxy, err := parseProxyURL(raw)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("STREETEASY_PROXIES: %w", err))
+			continue
+		}
+		cfg.StreetEasyProxies = append(cfg.StreetEasyProxies, proxy)
+	}
+
+	profiles, unknown := selectHeaderProfiles(splitList(os.Getenv("STREETEASY_HEADER_PROFILES")))
+	if len(unknown) > 0 {
+		problems = append(problems, fmt.Errorf("STREETEASY_HEADER_PROFILES: unknown profile(s) %s (available: %s)",
+			strings.Join(unknown, ", "), strings.Join(headerProfileNames(), ", ")))
+	}
+	cfg.HeaderProfiles = profiles
+
+	duplicates, err := parseDuplicateMode(os.Getenv("DUPLICATE_LISTINGS"))
+	if err != nil {
+		problems = append(problems, fmt.Errorf("DUPLICATE_LISTINGS: %w", err))
+	}
+	cfg.Duplicates = duplicates
+
+	priceDrop, err := parsePriceDropThreshold(os.Getenv("PRICE_DROP_MIN"))
+	if err != nil {
+		problems = append(problems, fmt.Errorf("PRICE_DROP_MIN: %w", err))
+	}
+	cfg.PriceDrop = priceDrop
+
+	offMarketAfter, err := parseOffMarketAfter(os.Getenv("OFF_MARKET_AFTER_POLLS"))
+	if err != nil {
+		problems = append(problems, fmt.Errorf("OFF_MARKET_AFTER_POLLS: %w", err))
+	}
+	cfg.OffMarketAfter = offMarketAfter
+
+	if cfg.ConfigPath != "" {
+		fc, err := loadFileConfig(cfg.ConfigPath)
+		if err != nil {
+			// Nothing more to check without the file
+			return nil, errors.Join(append(problems, err)...)
+		}
+		if len(fc.Searches) > 0 {
+			cfg.Searches = fc.Searches
+		}
+		cfg.Routes = fc.Routes
+		if fc.Schedule != nil {
+			if err := fc.Schedule.Validate(); err != nil {
+				problems = append(problems, fmt.Errorf("default schedule: %w", err))
+			}
+			cfg.Schedule = *fc.Schedule
+		}
+		cfg.Areas = NewAreaCatalog(fc.AreaCatalog)
+	}
+
+	problems = append(problems, cfg.resolveAreaNames()...)
+	problems = append(problems, cfg.loadGeofenceFiles()...)
+	problems = append(problems, cfg.validateWebhooks()...)
+	problems = append(problems, cfg.validateSearches()...)
+	problems = append(problems, cfg.validateRoutes()...)
+
+	if len(problems) > 0 {
+		return nil, errors.Join(problems...)
+	}
+
+	return cfg, nil
+}
+
+// PollerOptions returns the poll behaviour settings
+func (c *Config) PollerOptions() PollerOptions {
+	return PollerOptions{
+		Duplicates:     c.Duplicates,
+		PriceDrop:      c.PriceDrop,
+		OffMarketAfter: c.OffMarketAfter,
+	}
+}
+
+// splitList splits a comma-separated environment value, dropping blanks
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseProxyURL parses an http, https or socks5 proxy URL
+func parseProxyURL(raw string) (*url.URL, error) {
+	proxy, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %q: %w", raw, err)
+	}
+	switch proxy.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("proxy URL %q must use http, https, socks5 or socks5h", proxy.Redacted())
+	}
+	if proxy.Host == "" {
+		return nil, fmt.Errorf("proxy URL %q has no host", proxy.Redacted())
+	}
+	return proxy, nil
+}
+
+// loadFileConfig reads and parses the JSON config file. Unknown keys are
+// rejected so a misspelled filter isn't silently dropped.
+func loadFileConfig(path string) (*fileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var fc fileConfig
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&fc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if decoder.More() {
+		return nil, errors.New("failed to parse config file: unexpected data after the top-level object")
+	}
+
+	return &fc, nil
+}
+
+// resolveAreaNames adds the IDs of each search's named areas to its Areas
+func (c *Config) resolveAreaNames() []error {
+	var problems []error
+	for i := range c.Searches {
+		search := &c.Searches[i]
+		if len(search.AreaNames) == 0 {
+			continue
+		}
+		ids, err := c.Areas.ResolveNames(search.AreaNames)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("search %q: %w", search.Name, err))
+			continue
+		}
+		for _, id := range ids {
+			if !containsInt(search.Areas, id) {
+				search.Areas = append(search.Areas, id)
+			}
+		}
+	}
+	return problems
+}
+
+// loadGeofenceFiles reads each search's GeoJSON files into its Geofences.
+// Relative paths are resolved against the config file's directory.
+func (c *Config) loadGeofenceFiles() []error {
+	var problems []error
+	for i := range c.Searches {
+		search := &c.Searches[i]
+		for _, path := range search.GeofenceFiles {
+			if !filepath.IsAbs(path) && c.ConfigPath != "" {
+				path = filepath.Join(filepath.Dir(c.ConfigPath), path)
+			}
+			geofence, err := LoadGeofenceFile(path)
+			if err != nil {
+				problems = append(problems, fmt.Errorf("search %q: %w", search.Name, err))
+				continue
+			}
+			search.Geofences = append(search.Geofences, geofence)
+		}
+	}
+	return problems
+}
+
+func containsInt(values []int, target int) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
+
+// labeledWebhook is a configured webhook URL and where it came from
+type labeledWebhook struct {
+	label string
+	url   string
+}
+
+// webhookLabels lists every configured webhook URL
+func (c *Config) webhookLabels() []labeledWebhook {
+	var webhooks []labeledWebhook
+	add := func(label, url string) {
+		if url != "" {
+			webhooks = append(webhooks, labeledWebhook{label: label, url: url})
+		}
+	}
+
+	add("DISCORD_WEBHOOK_URL", c.DiscordWebhookURL)
+	add("DISCORD_ERROR_WEBHOOK_URL", c.DiscordErrorWebhookURL)
+	add("DISCORD_STATUS_WEBHOOK_URL", c.DiscordStatusWebhookURL)
+	for _, search := range c.Searches {
+		add(fmt.Sprintf("search %q webhook", search.Name), search.Webhook)
+	}
+	for _, route := range c.Routes {
+		add(fmt.Sprintf("route %q webhook", route.Name), route.Webhook)
+	}
+	return webhooks
+}
+
+// validateWebhooks checks the shape of every configured webhook URL
+func (c *Config) validateWebhooks() []error {
+	var problems []error
+	for _, webhook := range c.webhookLabels() {
+		if err := ValidateWebhookURL(webhook.url); err != nil {
+			problems = append(problems, fmt.Errorf("%s: %w", webhook.label, err))
+		}
+	}
+	return problems
+}
+
+// validateSearches checks every search and rejects duplicate names
+func (c *Config) validateSearches() []error {
+	var problems []error
+	names := make(map[string]bool)
+	for i := range c.Searches {
+		if err := c.Searches[i].Validate(); err != nil {
+			problems = append(problems, err)
+		}
+		if names[c.Searches[i].Name] {
+			problems = append(problems, fmt.Errorf("duplicate search name %q", c.Searches[i].Name))
+		}
+		names[c.Searches[i].Name] = true
+	}
+	return problems
+}
+
+// validateRoutes checks every route and that referenced searches exist
+func (c *Config) validateRoutes() []error {
+	var problems []error
+	names := make(map[string]bool)
+	for _, search := range c.Searches {
+		names[search.Name] = true
+	}
+	for i := range c.Routes {
+		if err := c.Routes[i].Validate(); err != nil {
+			problems = append(problems, err)
+		}
+		for _, name := range c.Routes[i].Searches {
+			if !names[name] {
+				problems = append(problems, fmt.Errorf("route %q: unknown search %q", c.Routes[i].Name, name))
+			}
+		}
+	}
+	return problems
+}
+
+// UnknownAreaIDs lists area IDs used by searches that are not in the catalog.
+// The bundled catalog is unverified, so they are left to StreetEasy at load
+// time and the validate command only warns about them.
+func (c *Config) UnknownAreaIDs() []error {
+	var unknown []error
+	for _, search := range c.Searches {
+		for _, id := range search.Areas {
+			if _, ok := c.Areas.ByID(id); !ok {
+				unknown = append(unknown, fmt.Errorf("search %q: area ID %d is not in the area catalog", search.Name, id))
+			}
+		}
+	}
+	return unknown
+}
+
+// ScheduleFor returns the search's own schedule, or the default schedule
+func (c *Config) ScheduleFor(search Search) Schedule {
+	if search.Schedule != nil {
+		return *search.Schedule
+	}
+	return c.Schedule
 }
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	craigslistBaseURL = "https://newyork.craigslist.org"
+
+	craigslistRequestDelay   = 3 * time.Second
+	craigslistMaxAttempts    = 3
+	craigslistRetryBase      = 5 * time.Second
+	craigslistRetryMaxWait   = 1 * time.Minute
+	craigslistIDPrefix       = "craigslist:"
+	craigslistDescriptionCap = 2000
+)
+
+// craigslistSubareas maps boroughs to Craigslist's New York subarea codes
+var craigslistSubareas = map[string]string{
+	"Manhattan":     "mnh",
+	"Brooklyn":      "brk",
+	"Queens":        "que",
+	"Bronx":         "brx",
+	"Staten Island": "stn",
+}
+
+var (
+	craigslistPricePattern     = regexp.MustCompile(`\$\s?([\d,]+)`)
+	craigslistBedsPattern      = regexp.MustCompile(`(?i)\b(\d+)\s?(?:br|bd|bed|beds|bedroom|bedrooms)\b`)
+	craigslistSqftPattern      = regexp.MustCompile(`(?i)\b(\d+)\s?(?:ft2|ft²|sq\.? ?ft|sqft)`)
+	craigslistStudioPattern    = regexp.MustCompile(`(?i)\bstudio\b`)
+	craigslistHoodPattern      = regexp.MustCompile(`\(([^()]+)\)`)
+	craigslistPostIDPattern    = regexp.MustCompile(`/(\d+)\.html`)
+	craigslistThumbnailPattern = regexp.MustCompile(`_\d+x\d+(\.\w+)$`)
+	craigslistTagPattern       = regexp.MustCompile(`<[^>]*>`)
+	craigslistTrailingBeds     = regexp.MustCompile(`(?i)\s*\b\d+\s?(?:br|bd)\s*$`)
+)
+
+// CraigslistClient reads Craigslist apartment search results from the RSS
+// feed of the New York site. Searches map onto Craigslist's price and
+// bedroom parameters and the boroughs of their areas; neighborhoods,
+// bounding boxes and bedroom bounds are then checked client side since
+// Craigslist neighborhoods are free text.
+type CraigslistClient struct {
+	httpClient   *http.Client
+	baseURL      string
+	profile      headerProfile
+	requestDelay time.Duration
+	maxAttempts  int
+	retryBase    time.Duration
+	retryMaxWait time.Duration
+
+	// areasMu guards areas, which can be swapped on config reload
+	areasMu sync.Mutex
+	areas   *AreaCatalog
+}
+
+// NewCraigslistClient creates a Craigslist source. The area catalog maps a
+// search's StreetEasy area IDs to boroughs and neighborhood names.
+func NewCraigslistClient(areas *AreaCatalog) *CraigslistClient {
+	return &CraigslistClient{
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		baseURL:      craigslistBaseURL,
+		areas:        areas,
+		profile:      headerProfiles[0],
+		requestDelay: craigslistRequestDelay,
+		maxAttempts:  craigslistMaxAttempts,
+		retryBase:    craigslistRetryBase,
+		retryMaxWait: craigslistRetryMaxWait,
+	}
+}
+
+// Name returns the source name
+func (c *CraigslistClient) Name() string {
+	return SourceCraigslist
+}
+
+// FetchListings fetches the apartment feed for each borough the search
+// covers and keeps the posts that match the search
+func (c *CraigslistClient) FetchListings(ctx context.Context, search Search) (*FetchResult, error) {
+	if search.IsSale() {
+		return nil, errors.New("craigslist source only supports rental searches")
+	}
+
+	subareas, neighborhoods := c.resolveAreas(search)
+
+	// The feed only carries the most recent posts
+	result := &FetchResult{Partial: true}
+	seen := make(map[string]bool)
+	for i, subarea := range subareas {
+		if i > 0 {
+			// Be polite between feeds
+			if err := sleepContext(ctx, c.requestDelay); err != nil {
+				return nil, err
+			}
+		}
+
+		body, err := c.get(ctx, c.feedURL(search, subarea))
+		if err != nil {
+			return nil, fmt.Errorf("feed %s: %w", subarea, err)
+		}
+		listings, err := parseCraigslistFeed(body)
+		if err != nil {
+			return nil, &SourceError{Category: ErrorCategoryBadResponse, Message: "failed to parse feed", Err: err}
+		}
+		result.Pages++
+		result.TotalCount += len(listings)
+
+		for _, listing := range listings {
+			if seen[listing.ID] || !craigslistMatches(search, neighborhoods, listing) {
+				continue
+			}
+			seen[listing.ID] = true
+			listing.SearchName = search.Name
+			result.Listings = append(result.Listings, listing)
+		}
+	}
+
+	if len(result.Listings) < result.TotalCount {
+		log.Printf("Craigslist: kept %d of %d posts for search %q", len(result.Listings), result.TotalCount, search.Name)
+	}
+	return result, nil
+}
+
+// Reconfigure swaps in a new area catalog
+func (c *CraigslistClient) Reconfigure(areas *AreaCatalog) {
+	c.areasMu.Lock()
+	defer c.areasMu.Unlock()
+
+	c.areas = areas
+}
+
+// catalog returns the current area catalog
+func (c *CraigslistClient) catalog() *AreaCatalog {
+	c.areasMu.Lock()
+	defer c.areasMu.Unlock()
+
+	return c.areas
+}
+
+// resolveAreas returns the subareas to fetch and the neighborhood names a
+// post must be in. A search that includes a whole borough accepts any post
+// from that borough's feed, so neighborhoods is nil when every area is a borough.
+func (c *CraigslistClient) resolveAreas(search Search) (subareas []string, neighborhoods map[string]bool) {
+	areas := c.catalog()
+	wholeBoroughs := make(map[string]bool)
+	for _, id := range search.Areas {
+		area, ok := areas.ByID(id)
+		if !ok {
+			continue
+		}
+		subarea, ok := craigslistSubareas[area.Borough]
+		if !ok {
+			continue
+		}
+		if !containsString(subareas, subarea) {
+			subareas = append(subareas, subarea)
+		}
+
+		if area.ParentID == 0 {
+			wholeBoroughs[subarea] = true
+			continue
+		}
+		if neighborhoods == nil {
+			neighborhoods = make(map[string]bool)
+		}
+		for _, name := range areaNames(areas, area) {
+			neighborhoods[normalizeAreaName(name)] = true
+		}
+	}
+
+	// Fall back to the whole city when no area maps onto a borough
+	if len(subareas) == 0 {
+		if len(search.Areas) > 0 {
+			log.Printf("Craigslist: no area of search %q (%v) is in the area catalog; fetching the whole city without a neighborhood filter",
+				search.Name, search.Areas)
+		}
+		return []string{""}, nil
+	}
+	if len(wholeBoroughs) == len(subareas) {
+		neighborhoods = nil
+	}
+	return subareas, neighborhoods
+}
+
+// areaNames returns the names of an area and everything inside it
+func areaNames(areas *AreaCatalog, area Area) []string {
+	names := []string{area.Name}
+	for _, child := range areas.Children(area.ID) {
+		names = append(names, areaNames(areas, child)...)
+	}
+	return names
+}
+
+// feedURL builds the RSS search URL for a subarea ("" for the whole city)
+func (c *CraigslistClient) feedURL(search Search, subarea string) string {
+	params := url.Values{}
+	params.Set("format", "rss")
+	params.Set("availabilityMode", "0")
+	if search.MinPrice > 0 {
+		params.Set("min_price", strconv.Itoa(search.MinPrice))
+	}
+	if search.MaxPrice > 0 {
+		params.Set("max_price", strconv.Itoa(search.MaxPrice))
+	}
+	if search.MinBeds != nil {
+		params.Set("min_bedrooms", strconv.Itoa(*search.MinBeds))
+	}
+	if search.MaxBeds != nil {
+		params.Set("max_bedrooms", strconv.Itoa(*search.MaxBeds))
+	}
+
+	path := "/search/apa"
+	if subarea != "" {
+		path = "/search/" + subarea + "/apa"
+	}
+	return c.baseURL + path + "?" + params.Encode()
+}
+
+// get fetches a feed, retrying transient failures with backoff
+func (c *CraigslistClient) get(ctx context.Context, feedURL string) ([]byte, error) {
+	attempt := func() ([]byte, error) {
+		return c.getOnce(ctx, feedURL)
+	}
+	return retryRequest(ctx, SourceCraigslist, c.maxAttempts, c.retryBase, c.retryMaxWait, attempt, nil)
+}
+
+// getOnce makes a single request attempt
+func (c *CraigslistClient) getOnce(ctx context.Context, feedURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", feedURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/rss+xml, application/xml;q=0.9, */*;q=0.8")
+	c.profile.apply(req.Header)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, &SourceError{Category: ErrorCategoryNetwork, Message: "failed to execute request", Err: err}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &SourceError{Category: ErrorCategoryNetwork, Message: "failed to read response body", Err: err}
+	}
+
+	// Craigslist serves its block notice as an HTML page
+	if resp.StatusCode != http.StatusOK || blockPageKind(resp, body) != "" {
+		return nil, statusError(SourceCraigslist, resp, body)
+	}
+
+	return body, nil
+}
+
+// craigslistFeed is the RSS 1.0 document Craigslist serves for format=rss.
+// Fields are matched by local name, so dc:date and enc:enclosure decode
+// without declaring their namespaces.
+type craigslistFeed struct {
+	Items []craigslistItem `xml:"item"`
+}
+
+type craigslistItem struct {
+	About       string `xml:"about,attr"`
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	Enclosure   struct {
+		Resource string `xml:"resource,attr"`
+	} `xml:"enclosure"`
+	Latitude  string `xml:"lat"`
+	Longitude string `xml:"long"`
+}
+
+// parseCraigslistFeed parses a Craigslist RSS feed into rental listings
+func parseCraigslistFeed(body []byte) ([]Listing, error) {
+	var feed craigslistFeed
+	decoder := xml.NewDecoder(strings.NewReader(string(body)))
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+	if err := decoder.Decode(&feed); err != nil {
+		return nil, err
+	}
+
+	var listings []Listing
+	for _, item := range feed.Items {
+		if listing, ok := item.toListing(); ok {
+			listings = append(listings, listing)
+		}
+	}
+	return listings, nil
+}
+
+// toListing maps a feed item onto a Listing. Craigslist puts price, bedrooms,
+// size and neighborhood in the free-text title, so they are parsed out of it.
+// Items without a post ID are skipped.
+func (item craigslistItem) toListing() (Listing, bool) {
+	link := strings.TrimSpace(item.Link)
+	if link == "" {
+		link = strings.TrimSpace(item.About)
+	}
+	match := craigslistPostIDPattern.FindStringSubmatch(link)
+	if match == nil {
+		return Listing{}, false
+	}
+
+	title := strings.TrimSpace(html.UnescapeString(item.Title))
+	listing := Listing{
+		ID:       craigslistIDPrefix + match[1],
+		Kind:     ListingKindRental,
+		Source:   SourceCraigslist,
+		URLPath:  link,
+		Headline: cleanCraigslistTitle(title),
+		Status:   "ACTIVE",
+	}
+
+	if m := craigslistPricePattern.FindStringSubmatch(title); m != nil {
+		listing.Price, _ = strconv.Atoi(strings.ReplaceAll(m[1], ",", ""))
+	}
+	if m := craigslistBedsPattern.FindStringSubmatch(title); m != nil {
+		listing.BedroomCount, _ = strconv.Atoi(m[1])
+	}
+	if matches := craigslistHoodPattern.FindAllStringSubmatch(title, -1); len(matches) > 0 {
+		listing.AreaName = strings.TrimSpace(matches[len(matches)-1][1])
+	}
+
+	lat, latErr := strconv.ParseFloat(strings.TrimSpace(item.Latitude), 64)
+	lng, lngErr := strconv.ParseFloat(strings.TrimSpace(item.Longitude), 64)
+	if latErr == nil && lngErr == nil {
+		listing.Latitude, listing.Longitude = lat, lng
+	}
+
+	if image := strings.TrimSpace(item.Enclosure.Resource); image != "" {
+		// Feed images are thumbnails; ask for the larger size
+		listing.PhotoKey = craigslistThumbnailPattern.ReplaceAllString(image, "_600x450$1")
+	}
+
+	// Craigslist has no detail query, so keep what the feed gives us
+	description := strings.TrimSpace(html.UnescapeString(craigslistTagPattern.ReplaceAllString(item.Description, " ")))
+	description = strings.Join(strings.Fields(description), " ")
+	details := &ListingDetails{
+		ListingID:   listing.ID,
+		Description: truncate(description, craigslistDescriptionCap),
+		FetchedAt:   time.Now(),
+	}
+	if m := craigslistSqftPattern.FindStringSubmatch(title); m != nil {
+		details.SquareFeet, _ = strconv.Atoi(m[1])
+	}
+	if details.Description != "" || details.SquareFeet > 0 {
+		listing.Details = details
+	}
+
+	listing.normalizeAddress()
+	return listing, true
+}
+
+// cleanCraigslistTitle drops the price, size and neighborhood that Craigslist
+// folds into feed titles, leaving the poster's own headline
+func cleanCraigslistTitle(title string) string {
+	cleaned := craigslistPricePattern.ReplaceAllString(title, "")
+	cleaned = craigslistSqftPattern.ReplaceAllString(cleaned, "")
+	if matches := craigslistHoodPattern.FindAllStringIndex(cleaned, -1); len(matches) > 0 {
+		last := matches[len(matches)-1]
+		cleaned = cleaned[:last[0]] + cleaned[last[1]:]
+	}
+	// Separators left by the removed parts can hide a trailing bedroom count
+	cleaned = strings.Trim(strings.Join(strings.Fields(cleaned), " "), " /-")
+	cleaned = strings.Trim(craigslistTrailingBeds.ReplaceAllString(cleaned, ""), " /-")
+	if cleaned == "" {
+		return title
+	}
+	return cleaned
+}
+
+// craigslistMatches applies the parts of a search Craigslist can't filter on
+func craigslistMatches(search Search, neighborhoods map[string]bool, listing Listing) bool {
+	if neighborhoods != nil && !craigslistInNeighborhood(neighborhoods, listing.AreaName) {
+		return false
+	}
+
+	if search.MinPrice > 0 && listing.Price < search.MinPrice {
+		return false
+	}
+	if search.MaxPrice > 0 && listing.Price > search.MaxPrice {
+		return false
+	}
+
+	// A studio title with no bedroom count is a zero-bedroom listing; other
+	// titles without one can't be checked, so they are kept
+	hasBeds := listing.BedroomCount > 0 || craigslistStudioPattern.MatchString(listing.Headline)
+	if hasBeds {
+		if search.MinBeds != nil && listing.BedroomCount < *search.MinBeds {
+			return false
+		}
+		if search.MaxBeds != nil && listing.BedroomCount > *search.MaxBeds {
+			return false
+		}
+	}
+
+	if search.BoundingBox != nil && listing.HasCoordinates() {
+		box := search.BoundingBox
+		if listing.Latitude > box.TopLeft.Latitude || listing.Latitude < box.BottomRight.Latitude ||
+			listing.Longitude < box.TopLeft.Longitude || listing.Longitude > box.BottomRight.Longitude {
+			return false
+		}
+	}
+
+	return true
+}
+
+// craigslistInNeighborhood reports whether a free-text Craigslist
+// neighborhood such as "Williamsburg / Greenpoint" names one of the wanted areas
+func craigslistInNeighborhood(neighborhoods map[string]bool, areaName string) bool {
+	for _, part := range strings.FieldsFunc(areaName, func(r rune) bool {
+		return r == '/' || r == ',' || r == '&' || r == '|'
+	}) {
+		if neighborhoods[normalizeAreaName(part)] {
+			return true
+		}
+	}
+	return false
+}
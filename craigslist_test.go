@@ -0,0 +1,329 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestParseCraigslistFeed(t *testing.T) {
+	body, err := os.ReadFile("testdata/craigslist_brooklyn.rss")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listings, err := parseCraigslistFeed(body)
+	if err != nil {
+		t.Fatalf("parseCraigslistFeed: %v", err)
+	}
+
+	// The last item links to a search page rather than a post, so it is skipped
+	if len(listings) != 3 {
+		t.Fatalf("got %d listings, want 3", len(listings))
+	}
+
+	tests := []struct {
+		id        string
+		price     int
+		beds      int
+		areaName  string
+		headline  string
+		photoKey  string
+		latitude  float64
+		sqft      int
+		hasDetail bool
+	}{
+		{
+			id:        "craigslist:7791234567",
+			price:     3200,
+			beds:      2,
+			areaName:  "Williamsburg",
+			headline:  "Sunny 2BR with balcony near the L",
+			photoKey:  "https://images.craigslist.org/00a0a_8Xk2pQmT1nZ_0CI0t2_600x450.jpg",
+			latitude:  40.7142,
+			sqft:      800,
+			hasDetail: true,
+		},
+		{
+			id:        "craigslist:7791234568",
+			price:     3200,
+			beds:      2,
+			areaName:  "Williamsburg / Greenpoint",
+			headline:  "$3,200 / 2br - 800ft2 - (Williamsburg / Greenpoint)",
+			sqft:      800,
+			hasDetail: true,
+		},
+		{
+			id:        "craigslist:7791234569",
+			price:     2450,
+			beds:      0,
+			areaName:  "Williamsburg",
+			headline:  "Bright studio near Bedford Ave",
+			photoKey:  "https://images.craigslist.org/00b0b_3Rt5uVwX9yA_0t20CI_600x450.jpg",
+			latitude:  40.7178,
+			hasDetail: true,
+		},
+	}
+
+	for i, want := range tests {
+		got := listings[i]
+		if got.ID != want.id {
+			t.Errorf("listing %d: ID = %q, want %q", i, got.ID, want.id)
+		}
+		if got.Source != SourceCraigslist || got.Kind != ListingKindRental || got.Status != "ACTIVE" {
+			t.Errorf("%s: source/kind/status = %q/%q/%q", want.id, got.Source, got.Kind, got.Status)
+		}
+		if got.Price != want.price {
+			t.Errorf("%s: Price = %d, want %d", want.id, got.Price, want.price)
+		}
+		if got.BedroomCount != want.beds {
+			t.Errorf("%s: BedroomCount = %d, want %d", want.id, got.BedroomCount, want.beds)
+		}
+		if got.AreaName != want.areaName {
+			t.Errorf("%s: AreaName = %q, want %q", want.id, got.AreaName, want.areaName)
+		}
+		if got.Headline != want.headline {
+			t.Errorf("%s: Headline = %q, want %q", want.id, got.Headline, want.headline)
+		}
+		if got.PhotoKey != want.photoKey {
+			t.Errorf("%s: PhotoKey = %q, want %q", want.id, got.PhotoKey, want.photoKey)
+		}
+		if got.Latitude != want.latitude {
+			t.Errorf("%s: Latitude = %v, want %v", want.id, got.Latitude, want.latitude)
+		}
+		if (got.Details != nil) != want.hasDetail {
+			t.Fatalf("%s: Details = %v, want present %v", want.id, got.Details, want.hasDetail)
+		}
+		if got.Details != nil && got.Details.SquareFeet != want.sqft {
+			t.Errorf("%s: SquareFeet = %d, want %d", want.id, got.Details.SquareFeet, want.sqft)
+		}
+		if got.URL() != got.URLPath {
+			t.Errorf("%s: URL() = %q, want the post link %q", want.id, got.URL(), got.URLPath)
+		}
+	}
+
+	// Markup and entities are stripped from the description
+	want := "Top floor two bedroom with a private balcony. Laundry in building, heat & hot water included. [...]"
+	if got := listings[0].Details.Description; got != want {
+		t.Errorf("Description = %q, want %q", got, want)
+	}
+}
+
+func TestParseCraigslistFeedEmpty(t *testing.T) {
+	body := []byte(`<?xml version="1.0"?><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"><channel></channel></rdf:RDF>`)
+	listings, err := parseCraigslistFeed(body)
+	if err != nil {
+		t.Fatalf("parseCraigslistFeed: %v", err)
+	}
+	if len(listings) != 0 {
+		t.Errorf("got %d listings, want 0", len(listings))
+	}
+}
+
+func TestCraigslistFeedIsNotBlockPage(t *testing.T) {
+	rss := http.Header{"Content-Type": []string{"application/rss+xml; charset=utf-8"}}
+	html := http.Header{"Content-Type": []string{"text/html; charset=utf-8"}}
+
+	tests := []struct {
+		name   string
+		header http.Header
+		body   string
+		want   string
+	}{
+		{"feed quoting a marker", rss, `<?xml version="1.0"?><rdf:RDF><item><description>Are you a robot? Press &amp; hold to tour</description></item></rdf:RDF>`, ""},
+		{"captcha page", html, `<html><body>Please complete the captcha</body></html>`, "captcha page"},
+		{"html page", html, `<!DOCTYPE html><html><body>Oops</body></html>`, "HTML page instead of data"},
+		{"captcha page without a content type", http.Header{}, `Are you a robot?`, "captcha page"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: http.StatusOK, Header: tt.header}
+			if got := blockPageKind(resp, []byte(tt.body)); got != tt.want {
+				t.Errorf("blockPageKind = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCraigslistItemToListing(t *testing.T) {
+	tests := []struct {
+		name   string
+		item   craigslistItem
+		wantOK bool
+		wantID string
+	}{
+		{
+			name:   "post link",
+			item:   craigslistItem{Link: "https://newyork.craigslist.org/mnh/apa/d/new-york-1br/7790000001.html", Title: "$2,900 / 1br"},
+			wantOK: true,
+			wantID: "craigslist:7790000001",
+		},
+		{
+			name:   "falls back to rdf:about",
+			item:   craigslistItem{About: "https://newyork.craigslist.org/que/apa/d/astoria-2br/7790000002.html", Title: "$2,600 / 2br"},
+			wantOK: true,
+			wantID: "craigslist:7790000002",
+		},
+		{
+			name:   "no post ID",
+			item:   craigslistItem{Link: "https://newyork.craigslist.org/search/brk/apa", Title: "Broker listings"},
+			wantOK: false,
+		},
+		{
+			name:   "no link at all",
+			item:   craigslistItem{Title: "$3,000 / 2br"},
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listing, ok := tt.item.toListing()
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && listing.ID != tt.wantID {
+				t.Errorf("ID = %q, want %q", listing.ID, tt.wantID)
+			}
+		})
+	}
+
+	// A post with no price, size or coordinates still maps, leaving them zero
+	listing, ok := craigslistItem{
+		Link:  "https://newyork.craigslist.org/brk/apa/d/brooklyn-room/7790000003.html",
+		Title: "Sunny room in shared apartment",
+	}.toListing()
+	if !ok {
+		t.Fatal("toListing rejected a post with a post ID")
+	}
+	if listing.Price != 0 || listing.BedroomCount != 0 || listing.HasCoordinates() || listing.Details != nil {
+		t.Errorf("unexpected values parsed from a bare title: %+v", listing)
+	}
+}
+
+func TestCleanCraigslistTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Sunny 2BR with balcony near the L (Williamsburg) $3,200 2br - 800ft²", "Sunny 2BR with balcony near the L"},
+		{"Bright studio near Bedford Ave (Williamsburg) $2,450", "Bright studio near Bedford Ave"},
+		{"Huge 3 bedroom, 2 bath (Park Slope) $5,100 3br - 1200ft2", "Huge 3 bedroom, 2 bath"},
+		// Nothing but the parts Craigslist adds: keep the title as is
+		{"$3,200 / 2br - 800ft2 - (Williamsburg / Greenpoint)", "$3,200 / 2br - 800ft2 - (Williamsburg / Greenpoint)"},
+		{"No fee renovated 2 bed", "No fee renovated 2 bed"},
+	}
+
+	for _, tt := range tests {
+		if got := cleanCraigslistTitle(tt.title); got != tt.want {
+			t.Errorf("cleanCraigslistTitle(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestCraigslistMatches(t *testing.T) {
+	two, three := 2, 3
+	search := Search{
+		Name:     "2br-north-brooklyn",
+		MinPrice: 2000,
+		MaxPrice: 4000,
+		MinBeds:  &two,
+		MaxBeds:  &two,
+		BoundingBox: &BoundingBox{
+			TopLeft:     GeoPoint{Latitude: 40.74, Longitude: -73.97},
+			BottomRight: GeoPoint{Latitude: 40.70, Longitude: -73.93},
+		},
+	}
+	neighborhoods := map[string]bool{
+		normalizeAreaName("Williamsburg"): true,
+		normalizeAreaName("Greenpoint"):   true,
+	}
+
+	base := Listing{Price: 3200, BedroomCount: 2, AreaName: "Williamsburg / Greenpoint", Latitude: 40.7142, Longitude: -73.9556}
+	with := func(change func(*Listing)) Listing {
+		listing := base
+		change(&listing)
+		return listing
+	}
+
+	tests := []struct {
+		name    string
+		search  Search
+		listing Listing
+		want    bool
+	}{
+		{"matches", search, base, true},
+		{"neighborhood in a list", search, with(func(l *Listing) { l.AreaName = "Bushwick, Greenpoint" }), true},
+		{"other neighborhood", search, with(func(l *Listing) { l.AreaName = "Park Slope" }), false},
+		{"no neighborhood", search, with(func(l *Listing) { l.AreaName = "" }), false},
+		{"under min price", search, with(func(l *Listing) { l.Price = 1800 }), false},
+		{"over max price", search, with(func(l *Listing) { l.Price = 4500 }), false},
+		{"too many beds", search, with(func(l *Listing) { l.BedroomCount = 3 }), false},
+		{"studio", search, with(func(l *Listing) { l.BedroomCount = 0; l.Headline = "Bright studio near Bedford Ave" }), false},
+		{"bed count unknown", search, with(func(l *Listing) { l.BedroomCount = 0; l.Headline = "Sunny apartment" }), true},
+		{"outside bounding box", search, with(func(l *Listing) { l.Latitude = 40.65 }), false},
+		{"no coordinates", search, with(func(l *Listing) { l.Latitude, l.Longitude = 0, 0 }), true},
+		{"three bed search", Search{MinBeds: &three}, base, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := craigslistMatches(tt.search, neighborhoods, tt.listing); got != tt.want {
+				t.Errorf("craigslistMatches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// A whole-borough search has no neighborhood filter
+	if !craigslistMatches(Search{}, nil, with(func(l *Listing) { l.AreaName = "Park Slope" })) {
+		t.Error("craigslistMatches rejected a listing with no neighborhood filter")
+	}
+}
+
+func TestCraigslistResolveAreas(t *testing.T) {
+	catalog := &AreaCatalog{byID: make(map[int]Area), byName: make(map[string]Area)}
+	for _, area := range []Area{
+		{ID: 1, Name: "Brooklyn", Borough: "Brooklyn"},
+		{ID: 10, Name: "North Brooklyn", Borough: "Brooklyn", ParentID: 1},
+		{ID: 11, Name: "Williamsburg", Borough: "Brooklyn", ParentID: 10},
+		{ID: 12, Name: "Greenpoint", Borough: "Brooklyn", ParentID: 10},
+		{ID: 13, Name: "Park Slope", Borough: "Brooklyn", ParentID: 1},
+		{ID: 2, Name: "Manhattan", Borough: "Manhattan"},
+		{ID: 20, Name: "Chelsea", Borough: "Manhattan", ParentID: 2},
+	} {
+		catalog.add(area)
+	}
+	client := NewCraigslistClient(catalog)
+
+	// A group brings in the names of its neighborhoods
+	subareas, neighborhoods := client.resolveAreas(Search{Areas: []int{10}})
+	if len(subareas) != 1 || subareas[0] != "brk" {
+		t.Errorf("subareas = %v, want [brk]", subareas)
+	}
+	for _, name := range []string{"North Brooklyn", "Williamsburg", "Greenpoint"} {
+		if !neighborhoods[normalizeAreaName(name)] {
+			t.Errorf("neighborhoods missing %q", name)
+		}
+	}
+	if neighborhoods[normalizeAreaName("Park Slope")] {
+		t.Error("neighborhoods include Park Slope")
+	}
+
+	// Neighborhoods in two boroughs fetch both feeds
+	subareas, _ = client.resolveAreas(Search{Areas: []int{11, 20}})
+	if len(subareas) != 2 || subareas[0] != "brk" || subareas[1] != "mnh" {
+		t.Errorf("two boroughs: subareas = %v, want [brk mnh]", subareas)
+	}
+
+	// A whole borough has no neighborhood filter
+	if _, neighborhoods = client.resolveAreas(Search{Areas: []int{1}}); neighborhoods != nil {
+		t.Errorf("borough search: neighborhoods = %v, want nil", neighborhoods)
+	}
+
+	// Areas missing from the catalog fall back to the whole city
+	subareas, neighborhoods = client.resolveAreas(Search{Name: "unknown", Areas: []int{99}})
+	if len(subareas) != 1 || subareas[0] != "" || neighborhoods != nil {
+		t.Errorf("unknown areas: subareas = %v, neighborhoods = %v", subareas, neighborhoods)
+	}
+}
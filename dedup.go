@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DuplicateMode says what happens to a new listing for an apartment that
+// was already notified under another ID or on another source
+type DuplicateMode string
+
+const (
+	// DuplicatesNote sends a short "relisted" or "also on" note instead of
+	// a full notification
+	DuplicatesNote DuplicateMode = "note"
+
+	// DuplicatesSuppress records the duplicate without notifying
+	DuplicatesSuppress DuplicateMode = "suppress"
+
+	// DuplicatesOff treats every new ID as a new listing
+	DuplicatesOff DuplicateMode = "off"
+)
+
+// duplicatePriceTolerance is how far apart two prices may be, as a fraction
+// of the lower one, for two listings to count as the same apartment
+const duplicatePriceTolerance = 0.05
+
+// duplicateCoordinateTolerance is how far apart, in degrees (roughly 30m),
+// two listings may be when one has no street and they are matched by location
+const duplicateCoordinateTolerance = 0.0003
+
+// parseDuplicateMode parses a DUPLICATE_LISTINGS value, defaulting to note
+func parseDuplicateMode(value string) (DuplicateMode, error) {
+	switch mode := DuplicateMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "":
+		return DuplicatesNote, nil
+	case DuplicatesNote, DuplicatesSuppress, DuplicatesOff:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("must be %q, %q or %q, got %q", DuplicatesNote, DuplicatesSuppress, DuplicatesOff, value)
+	}
+}
+
+// dedupKeyFor returns the canonical key for the apartment a listing is for:
+// its kind, normalized street (see NormalizeStreet) and unit, and bedroom count. Price is left out
+// so relistings with a changed price still match; callers compare it
+// approximately. Listings without a street have no key.
+func dedupKeyFor(listing Listing) string {
+	street := strings.ToLower(NormalizeStreet(listing.Street))
+	if street == "" {
+		return ""
+	}
+
+	unit := strings.ToLower(ParseUnit(listing.Unit).Normalized)
+
+	return fmt.Sprintf("%s|%s|%s|%d", duplicateKind(listing), street, unit, listing.BedroomCount)
+}
+
+// duplicateKind returns a listing's kind as stored, defaulting to rental
+func duplicateKind(listing Listing) ListingKind {
+	if listing.Kind == "" {
+		return ListingKindRental
+	}
+	return listing.Kind
+}
+
+// similarPrice reports whether two prices are within duplicatePriceTolerance
+func similarPrice(a, b int) bool {
+	if a <= 0 || b <= 0 {
+		return a == b
+	}
+	low, high := min(a, b), max(a, b)
+	return float64(high-low) <= float64(low)*duplicatePriceTolerance
+}
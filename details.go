@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// detailsCacheTTL is how long stored listing details are reused before refetching
+const detailsCacheTTL = 7 * 24 * time.Hour
+
+// rentalDetailsQuery is the GraphQL query for a single rental's details
+const rentalDetailsQuery = `
+  query GetRentalDetails($id: ID!) {
+    rental(id: $id) {
+      id
+      sqft
+      noFee
+      availableAt
+      description
+      amenities
+      concessions {
+        monthsFree
+        leaseTermMonths
+        description
+      }
+      photos {
+        key
+      }
+      floorPlans {
+        key
+      }
+    }
+  }
+`
+
+// rentalStatusQuery and saleStatusQuery look up a single listing's status
+const rentalStatusQuery = `
+  query GetRentalStatus($id: ID!) {
+    rental(id: $id) {
+      id
+      status
+    }
+  }
+`
+
+const saleStatusQuery = `
+  query GetSaleStatus($id: ID!) {
+    sale(id: $id) {
+      id
+      status
+    }
+  }
+`
+
+// ListingDetails is the extra information from a listing's detail page
+type ListingDetails struct {
+	ListingID   string
+	SquareFeet  int
+	NoFee       bool
+	AvailableAt string
+	Amenities   []string
+	Description string
+	Concessions string
+	PhotoKeys   []string
+	FloorPlans  []string
+	FetchedAt   time.Time
+}
+
+// Fresh reports whether cached details are recent enough to reuse
+func (d *ListingDetails) Fresh() bool {
+	return time.Since(d.FetchedAt) < detailsCacheTTL
+}
+
+// GraphQL response structures for the details query
+
+type RentalDetailsResponse struct {
+	Data   *RentalDetailsData `json:"data"`
+	Errors []GraphQLError     `json:"errors,omitempty"`
+}
+
+type RentalDetailsData struct {
+	Rental *RentalDetailsNode `json:"rental"`
+}
+
+type RentalDetailsNode struct {
+	ID          string             `json:"id"`
+	Sqft        int                `json:"sqft"`
+	NoFee       bool               `json:"noFee"`
+	AvailableAt string             `json:"availableAt"`
+	Description string             `json:"description"`
+	Amenities   []string           `json:"amenities"`
+	Concessions []RentalConcession `json:"concessions"`
+	Photos      []Photo            `json:"photos"`
+	FloorPlans  []Photo            `json:"floorPlans"`
+}
+
+type ListingStatusResponse struct {
+	Data   *ListingStatusData `json:"data"`
+	Errors []GraphQLError     `json:"errors,omitempty"`
+}
+
+type ListingStatusData struct {
+	Rental *ListingStatusNode `json:"rental"`
+	Sale   *ListingStatusNode `json:"sale"`
+}
+
+type ListingStatusNode struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+type RentalConcession struct {
+	MonthsFree      float64 `json:"monthsFree"`
+	LeaseTermMonths int     `json:"leaseTermMonths"`
+	Description     string  `json:"description"`
+}
+
+// ToDetails converts the API node into ListingDetails
+func (n *RentalDetailsNode) ToDetails() *ListingDetails {
+	var concessions []string
+	for _, c := range n.Concessions {
+		switch {
+		case c.Description != "":
+			concessions = append(concessions, c.Description)
+		case c.MonthsFree > 0 && c.LeaseTermMonths > 0:
+			concessions = append(concessions, fmt.Sprintf("%g month(s) free on a %d-month lease", c.MonthsFree, c.LeaseTermMonths))
+		case c.MonthsFree > 0:
+			concessions = append(concessions, fmt.Sprintf("%g month(s) free", c.MonthsFree))
+		}
+	}
+
+	return &ListingDetails{
+		PhotoKeys:   photoKeys(n.Photos),
+		FloorPlans:  photoKeys(n.FloorPlans),
+		ListingID:   n.ID,
+		SquareFeet:  n.Sqft,
+		NoFee:       n.NoFee,
+		AvailableAt: n.AvailableAt,
+		Amenities:   n.Amenities,
+		Description: strings.TrimSpace(n.Description),
+		Concessions: strings.Join(concessions, "; "),
+		FetchedAt:   time.Now(),
+	}
+}
+
+// photoKeys extracts the non-empty keys from a list of photos
+func photoKeys(photos []Photo) []string {
+	var keys []string
+	for _, photo := range photos {
+		if photo.Key != "" {
+			keys = append(keys, photo.Key)
+		}
+	}
+	return keys
+}
+
+// FetchDetails fetches the detail page data for a rental listing. Requests
+// are spaced at least pageDelay apart, like search pages.
+func (c *StreetEasyClient) FetchDetails(ctx context.Context, listingID string) (*ListingDetails, error) {
+	if err := c.waitForDetailSlot(ctx); err != nil {
+		return nil, err
+	}
+
+	requestBody := map[string]interface{}{
+		"query": rentalDetailsQuery,
+		"variables": map[string]interface{}{
+			"id": listingID,
+		},
+	}
+
+	body, err := c.post(ctx, requestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	var detailsResponse RentalDetailsResponse
+	if err := json.Unmarshal(body, &detailsResponse); err != nil {
+		return nil, &SourceError{Category: ErrorCategoryBadResponse, Message: "failed to parse details response", Err: err}
+	}
+
+	if len(detailsResponse.Errors) > 0 {
+		return nil, &SourceError{Category: ErrorCategoryGraphQL, Message: detailsResponse.Errors[0].Message}
+	}
+
+	if detailsResponse.Data == nil || detailsResponse.Data.Rental == nil {
+		return nil, &SourceError{Category: ErrorCategoryBadResponse, Message: fmt.Sprintf("no details in response for listing %s", listingID)}
+	}
+
+	details := detailsResponse.Data.Rental.ToDetails()
+	details.ListingID = listingID
+	return details, nil
+}
+
+// FetchStatus looks up the current status of a listing, such as ACTIVE,
+// RENTED or SOLD. Requests share the pacing of detail requests.
+func (c *StreetEasyClient) FetchStatus(ctx context.Context, listingID string, kind ListingKind) (string, error) {
+	if err := c.waitForDetailSlot(ctx); err != nil {
+		return "", err
+	}
+
+	query := rentalStatusQuery
+	if kind == ListingKindSale {
+		query = saleStatusQuery
+	}
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"id": listingID,
+		},
+	}
+
+	body, err := c.post(ctx, requestBody)
+	if err != nil {
+		return "", err
+	}
+
+	var statusResponse ListingStatusResponse
+	if err := json.Unmarshal(body, &statusResponse); err != nil {
+		return "", &SourceError{Category: ErrorCategoryBadResponse, Message: "failed to parse status response", Err: err}
+	}
+
+	if len(statusResponse.Errors) > 0 {
+		return "", &SourceError{Category: ErrorCategoryGraphQL, Message: statusResponse.Errors[0].Message}
+	}
+
+	var node *ListingStatusNode
+	if statusResponse.Data != nil {
+		node = statusResponse.Data.Rental
+		if kind == ListingKindSale {
+			node = statusResponse.Data.Sale
+		}
+	}
+	if node == nil {
+		return "", &SourceError{Category: ErrorCategoryBadResponse, Message: fmt.Sprintf("no status in response for listing %s", listingID)}
+	}
+
+	return node.Status, nil
+}
+
+// waitForDetailSlot sleeps until pageDelay has passed since the last detail request
+func (c *StreetEasyClient) waitForDetailSlot(ctx context.Context) error {
+	c.detailMu.Lock()
+	defer c.detailMu.Unlock()
+
+	if wait := time.Until(c.lastDetailAt.Add(c.pageDelay)); wait > 0 {
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+	c.lastDetailAt = time.Now()
+	return nil
+}
@@ -2,30 +2,63 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
 )
 
 const (
-	discordEmbedColor      = 5814783  // Light blue color
-	discordErrorColor      = 15158332 // Red color
-	discordStatusColor     = 3066993  // Green color
+	discordEmbedColor  = 5814783  // Light blue color
+	discordErrorColor  = 15158332 // Red color
+	discordStatusColor = 3066993  // Green color
+	discordSaleColor   = 15844367 // Gold color
+
+	discordGallerySize = 4    // Images Discord shows for embeds sharing a url
+	discordFieldLimit  = 1024 // Longest embed field value Discord accepts
 )
 
+// webhookPathPattern matches /api[/vN]/webhooks/{id}/{token}
+var webhookPathPattern = regexp.MustCompile(`^/api(/v\d+)?/webhooks/\d+/[A-Za-z0-9_-]+/?$`)
+
+// ValidateWebhookURL checks that a URL looks like a Discord webhook
+func ValidateWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("webhook URL must use https, got %q", u.Scheme)
+	}
+	switch u.Host {
+	case "discord.com", "discordapp.com", "ptb.discord.com", "canary.discord.com":
+	default:
+		return fmt.Errorf("webhook URL host %q is not a Discord host", u.Host)
+	}
+	if !webhookPathPattern.MatchString(u.Path) {
+		return fmt.Errorf("webhook URL path %q is not /api/webhooks/{id}/{token}", u.Path)
+	}
+	return nil
+}
+
 // DiscordClient handles sending webhooks to Discord
 type DiscordClient struct {
-	webhookURL       string
+	mu               sync.RWMutex
+	router           *WebhookRouter
 	errorWebhookURL  string
 	statusWebhookURL string
 	httpClient       *http.Client
 }
 
 // NewDiscordClient creates a new Discord webhook client
-func NewDiscordClient(webhookURL, errorWebhookURL, statusWebhookURL string) *DiscordClient {
+func NewDiscordClient(router *WebhookRouter, errorWebhookURL, statusWebhookURL string) *DiscordClient {
 	return &DiscordClient{
-		webhookURL:       webhookURL,
+		router:           router,
 		errorWebhookURL:  errorWebhookURL,
 		statusWebhookURL: statusWebhookURL,
 		httpClient: &http.Client{
@@ -34,12 +67,135 @@ func NewDiscordClient(webhookURL, errorWebhookURL, statusWebhookURL string) *Dis
 	}
 }
 
-// SendListing sends a formatted listing embed to Discord
-func (d *DiscordClient) SendListing(listing Listing) error {
-	embed := d.buildEmbed(listing)
+// Reconfigure atomically swaps the webhook destinations
+func (d *DiscordClient) Reconfigure(router *WebhookRouter, errorWebhookURL, statusWebhookURL string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.router = router
+	d.errorWebhookURL = errorWebhookURL
+	d.statusWebhookURL = statusWebhookURL
+}
+
+// webhooks returns a consistent snapshot of the configured destinations
+func (d *DiscordClient) webhooks() (*WebhookRouter, string, string) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.router, d.errorWebhookURL, d.statusWebhookURL
+}
+
+// CheckWebhook confirms a webhook exists by fetching it
+func (d *DiscordClient) CheckWebhook(ctx context.Context, webhookURL string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", webhookURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("discord returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// SendListing sends a formatted listing embed to the webhook routed for it
+func (d *DiscordClient) SendListing(ctx context.Context, listing Listing) error {
+	return d.sendListingEmbeds(ctx, listing, d.buildEmbeds(listing))
+}
+
+// SendDuplicate sends a short note that a new listing is an apartment we
+// already notified, pointing back at the original listing
+func (d *DiscordClient) SendDuplicate(ctx context.Context, listing Listing, original *SeenListing) error {
+	title := fmt.Sprintf("Relisted: %s", listing.AreaName)
+	if original.Source != listing.Source && listing.Source != "" {
+		title = fmt.Sprintf("Also on %s: %s", listing.Source, listing.AreaName)
+	}
+
+	price := formatPrice(listing)
+	if original.Price > 0 && original.Price != listing.Price {
+		price = fmt.Sprintf("%s (was %s)", price, formatDollars(original.Price))
+	}
+
+	embed := map[string]interface{}{
+		"title":       title,
+		"url":         listing.URL(),
+		"description": listingAddress(listing),
+		"color":       discordEmbedColor,
+		"fields": []map[string]interface{}{
+			{
+				"name":   "Price",
+				"value":  price,
+				"inline": true,
+			},
+			{
+				"name": "Original",
+				"value": fmt.Sprintf("[Notified %s on %s](%s)",
+					original.FirstSeenAt.Format("Jan 2, 2006"), original.Source, original.URL()),
+				"inline": true,
+			},
+		},
+	}
+	if footer := listingFooter(listing); footer != nil {
+		embed["footer"] = footer
+	}
+
+	return d.sendListingEmbeds(ctx, listing, []map[string]interface{}{embed})
+}
 
+// SendPriceDrop sends a notice that a listing we already notified got cheaper
+func (d *DiscordClient) SendPriceDrop(ctx context.Context, listing Listing, previous int) error {
+	embed := map[string]interface{}{
+		"title": fmt.Sprintf("Price drop: %s → %s (%d%%)",
+			formatDollars(previous), formatDollars(listing.Price), priceChangePercent(previous, listing.Price)),
+		"url":         listing.URL(),
+		"description": fmt.Sprintf("%s\n%s", listing.AreaName, listingAddress(listing)),
+		"color":       discordStatusColor,
+	}
+	if listing.PhotoKey != "" {
+		embed["thumbnail"] = map[string]interface{}{"url": photoURL(listing.PhotoKey)}
+	}
+	if footer := listingFooter(listing); footer != nil {
+		embed["footer"] = footer
+	}
+
+	return d.sendListingEmbeds(ctx, listing, []map[string]interface{}{embed})
+}
+
+// SendBackOnMarket sends a short notice that a listing which had left the
+// market is being advertised again
+func (d *DiscordClient) SendBackOnMarket(ctx context.Context, listing Listing, change *LifecycleChange) error {
+	description := fmt.Sprintf("%s\n%s", listing.AreaName, listingAddress(listing))
+	if !change.OffMarketAt.IsZero() {
+		description += fmt.Sprintf("\nOff the market for %s (was %s)", formatDays(time.Since(change.OffMarketAt)), change.From)
+	}
+
+	embed := map[string]interface{}{
+		"title":       fmt.Sprintf("Back on market: %s", formatPrice(listing)),
+		"url":         listing.URL(),
+		"description": description,
+		"color":       discordStatusColor,
+	}
+	if listing.PhotoKey != "" {
+		embed["thumbnail"] = map[string]interface{}{"url": photoURL(listing.PhotoKey)}
+	}
+	if footer := listingFooter(listing); footer != nil {
+		embed["footer"] = footer
+	}
+
+	return d.sendListingEmbeds(ctx, listing, []map[string]interface{}{embed})
+}
+
+// sendListingEmbeds posts embeds about a listing to the webhook routed for it
+func (d *DiscordClient) sendListingEmbeds(ctx context.Context, listing Listing, embeds []map[string]interface{}) error {
 	payload := map[string]interface{}{
-		"embeds": []map[string]interface{}{embed},
+		"embeds": embeds,
 	}
 
 	jsonBody, err := json.Marshal(payload)
@@ -47,7 +203,8 @@ func (d *DiscordClient) SendListing(listing Listing) error {
 		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", d.webhookURL, bytes.NewBuffer(jsonBody))
+	router, _, _ := d.webhooks()
+	req, err := http.NewRequestWithContext(ctx, "POST", router.WebhookFor(listing), bytes.NewBuffer(jsonBody))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -74,13 +231,10 @@ func (d *DiscordClient) buildEmbed(listing Listing) map[string]interface{} {
 	title := listing.AreaName
 
 	// Description is the address
-	address := listing.Street
-	if listing.Unit != "" {
-		address = fmt.Sprintf("%s, Unit %s", listing.Street, listing.Unit)
-	}
+	address := listingAddress(listing)
 
 	// Build listing URL
-	listingURL := fmt.Sprintf("https://streeteasy.com%s", listing.URLPath)
+	listingURL := listing.URL()
 
 	// Build bedroom display
 	bedroomDisplay := "Studio"
@@ -102,10 +256,14 @@ func (d *DiscordClient) buildEmbed(listing Listing) map[string]interface{} {
 	}
 
 	// Build fields
+	priceName := "Price"
+	if listing.IsSale() {
+		priceName = "Asking Price"
+	}
 	fields := []map[string]interface{}{
 		{
-			"name":   "Price",
-			"value":  fmt.Sprintf("$%d/mo", listing.Price),
+			"name":   priceName,
+			"value":  formatPrice(listing),
 			"inline": true,
 		},
 		{
@@ -120,6 +278,65 @@ func (d *DiscordClient) buildEmbed(listing Listing) map[string]interface{} {
 		},
 	}
 
+	// Add the floor when the unit says where it is
+	if floor := listing.UnitInfo.FloorLabel(); floor != "" {
+		fields = append(fields, map[string]interface{}{
+			"name":   "Floor",
+			"value":  floor,
+			"inline": true,
+		})
+	}
+
+	// Add monthly carrying costs for sales
+	if listing.IsSale() {
+		for _, cost := range []struct {
+			name   string
+			amount int
+		}{
+			{"Maintenance", listing.Maintenance},
+			{"Common Charges", listing.CommonCharges},
+			{"Taxes", listing.Taxes},
+		} {
+			if cost.amount > 0 {
+				fields = append(fields, map[string]interface{}{
+					"name":   cost.name,
+					"value":  fmt.Sprintf("%s/mo", formatDollars(cost.amount)),
+					"inline": true,
+				})
+			}
+		}
+	}
+
+	// Add detail page data when enriched
+	if listing.Details != nil {
+		fields = append(fields, detailFields(listing.Details)...)
+		if listing.Details.Description != "" {
+			address = fmt.Sprintf("%s\n\n%s", address, truncate(listing.Details.Description, 300))
+		}
+	}
+
+	// Add Rello Express apply link when the listing supports it
+	if listing.RelloCTAEnabled && listing.RelloLink != "" {
+		relloURL := listing.RelloLink
+		if strings.HasPrefix(relloURL, "/") {
+			relloURL = "https://streeteasy.com" + relloURL
+		}
+		fields = append(fields, map[string]interface{}{
+			"name":   "Apply",
+			"value":  fmt.Sprintf("[Apply via Rello](%s)", relloURL),
+			"inline": true,
+		})
+	}
+
+	// Add map link if coordinates available
+	if listing.HasCoordinates() {
+		fields = append(fields, map[string]interface{}{
+			"name":   "Map",
+			"value":  fmt.Sprintf("[Open in Maps](https://www.google.com/maps?q=%f,%f)", listing.Latitude, listing.Longitude),
+			"inline": true,
+		})
+	}
+
 	// Add broker if available
 	if listing.SourceGroupLabel != "" {
 		fields = append(fields, map[string]interface{}{
@@ -129,35 +346,141 @@ func (d *DiscordClient) buildEmbed(listing Listing) map[string]interface{} {
 		})
 	}
 
+	color := discordEmbedColor
+	if listing.IsSale() {
+		title = fmt.Sprintf("%s (For Sale)", title)
+		color = discordSaleColor
+	}
+
 	embed := map[string]interface{}{
 		"title":       title,
 		"url":         listingURL,
 		"description": address,
-		"color":       discordEmbedColor,
+		"color":       color,
 		"fields":      fields,
 	}
 
-	// Add thumbnail if photo available
-	if listing.PhotoKey != "" {
-		photoURL := fmt.Sprintf("https://photos.zillowstatic.com/fp/%s-se_extra_large_1500_800.webp", listing.PhotoKey)
-		embed["thumbnail"] = map[string]interface{}{
-			"url": photoURL,
-		}
+	if footer := listingFooter(listing); footer != nil {
+		embed["footer"] = footer
 	}
 
 	return embed
 }
 
+// listingAddress is a listing's street and unit, or its headline when it
+// has no street
+func listingAddress(listing Listing) string {
+	if listing.Street == "" {
+		return listing.Headline
+	}
+	if listing.Unit != "" {
+		return fmt.Sprintf("%s, Unit %s", listing.Street, listing.Unit)
+	}
+	return listing.Street
+}
+
+// listingFooter notes which saved search matched a listing, and where, or
+// returns nil when neither is known
+func listingFooter(listing Listing) map[string]interface{} {
+	var parts []string
+	if listing.SearchName != "" {
+		parts = append(parts, fmt.Sprintf("Search: %s", listing.SearchName))
+	}
+	if listing.Source != "" {
+		parts = append(parts, fmt.Sprintf("Source: %s", listing.Source))
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	return map[string]interface{}{"text": strings.Join(parts, " · ")}
+}
+
+// buildEmbeds constructs the listing embed plus a photo gallery. Discord
+// groups embeds that share a url into one message with up to four images,
+// so each extra image is an embed carrying only the listing URL and image.
+func (d *DiscordClient) buildEmbeds(listing Listing) []map[string]interface{} {
+	embed := d.buildEmbed(listing)
+	embeds := []map[string]interface{}{embed}
+
+	images := galleryImages(listing)
+	if len(images) == 0 {
+		return embeds
+	}
+
+	// Large main image instead of a thumbnail
+	embed["image"] = map[string]interface{}{"url": images[0]}
+	for _, image := range images[1:] {
+		embeds = append(embeds, map[string]interface{}{
+			"url":   embed["url"],
+			"image": map[string]interface{}{"url": image},
+		})
+	}
+
+	return embeds
+}
+
+// galleryImages picks up to four image URLs: the lead photo, more photos,
+// and the first floor plan in the last slot when there is one
+func galleryImages(listing Listing) []string {
+	var keys []string
+	add := func(key string) {
+		if key != "" && !containsString(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+
+	add(listing.PhotoKey)
+	photoSlots := discordGallerySize
+	var floorPlan string
+	if listing.Details != nil {
+		if len(listing.Details.FloorPlans) > 0 {
+			floorPlan = listing.Details.FloorPlans[0]
+			photoSlots--
+		}
+		for _, key := range listing.Details.PhotoKeys {
+			if len(keys) >= photoSlots {
+				break
+			}
+			add(key)
+		}
+	}
+	if len(keys) > photoSlots {
+		keys = keys[:photoSlots]
+	}
+	add(floorPlan)
+
+	urls := make([]string, len(keys))
+	for i, key := range keys {
+		urls[i] = photoURL(key)
+	}
+	return urls
+}
+
+// photoURL builds the image URL for a StreetEasy photo key. Sources that
+// give full image URLs instead of keys are passed through.
+func photoURL(key string) string {
+	if strings.HasPrefix(key, "https://") || strings.HasPrefix(key, "http://") {
+		return key
+	}
+	return fmt.Sprintf("https://photos.zillowstatic.com/fp/%s-se_extra_large_1500_800.webp", key)
+}
+
 // SendError sends an error notification to the error webhook
-func (d *DiscordClient) SendError(errMsg string) error {
-	if d.errorWebhookURL == "" {
+func (d *DiscordClient) SendError(ctx context.Context, errMsg string) error {
+	return d.SendAlert(ctx, "Error", errMsg, discordErrorColor)
+}
+
+// SendAlert sends a titled notice to the error webhook
+func (d *DiscordClient) SendAlert(ctx context.Context, title, message string, color int) error {
+	_, errorWebhookURL, _ := d.webhooks()
+	if errorWebhookURL == "" {
 		return nil // No error webhook configured
 	}
 
 	embed := map[string]interface{}{
-		"title":       "Error",
-		"description": errMsg,
-		"color":       discordErrorColor,
+		"title":       title,
+		"description": message,
+		"color":       color,
 		"timestamp":   time.Now().Format(time.RFC3339),
 	}
 
@@ -170,7 +493,7 @@ func (d *DiscordClient) SendError(errMsg string) error {
 		return fmt.Errorf("failed to marshal error payload: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", d.errorWebhookURL, bytes.NewBuffer(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", errorWebhookURL, bytes.NewBuffer(jsonBody))
 	if err != nil {
 		return fmt.Errorf("failed to create error request: %w", err)
 	}
@@ -187,8 +510,9 @@ func (d *DiscordClient) SendError(errMsg string) error {
 }
 
 // SendStatus sends a status update to the status webhook
-func (d *DiscordClient) SendStatus(totalListings, newListings int, sampleListings []Listing) error {
-	if d.statusWebhookURL == "" {
+func (d *DiscordClient) SendStatus(ctx context.Context, scope string, totalListings, newListings int, sampleListings []Listing, warnings []string) error {
+	_, _, statusWebhookURL := d.webhooks()
+	if statusWebhookURL == "" {
 		return nil // No status webhook configured
 	}
 
@@ -198,32 +522,48 @@ func (d *DiscordClient) SendStatus(totalListings, newListings int, sampleListing
 		if i >= 3 { // Show max 3 samples
 			break
 		}
-		sampleText += fmt.Sprintf("• %s - %s, $%d/mo\n", listing.AreaName, listing.Street, listing.Price)
+		sampleText += fmt.Sprintf("• %s - %s, %s\n", listing.AreaName, listing.Street, formatPrice(listing))
 	}
 	if sampleText == "" {
 		sampleText = "No listings in response"
 	}
 
-	embed := map[string]interface{}{
-		"title": "Poll Complete",
-		"color": discordStatusColor,
-		"fields": []map[string]interface{}{
-			{
-				"name":   "Total Listings",
-				"value":  fmt.Sprintf("%d", totalListings),
-				"inline": true,
-			},
-			{
-				"name":   "New Listings",
-				"value":  fmt.Sprintf("%d", newListings),
-				"inline": true,
-			},
-			{
-				"name":   "Sample from Response",
-				"value":  sampleText,
-				"inline": false,
-			},
+	fields := []map[string]interface{}{
+		{
+			"name":   "Searches",
+			"value":  scope,
+			"inline": false,
+		},
+		{
+			"name":   "Total Listings",
+			"value":  fmt.Sprintf("%d", totalListings),
+			"inline": true,
+		},
+		{
+			"name":   "New Listings",
+			"value":  fmt.Sprintf("%d", newListings),
+			"inline": true,
+		},
+		{
+			"name":   "Sample from Response",
+			"value":  sampleText,
+			"inline": false,
 		},
+	}
+
+	// Surface problems like truncated results
+	if len(warnings) > 0 {
+		fields = append(fields, map[string]interface{}{
+			"name":   "Warnings",
+			"value":  "⚠️ " + strings.Join(warnings, "\n⚠️ "),
+			"inline": false,
+		})
+	}
+
+	embed := map[string]interface{}{
+		"title":     "Poll Complete",
+		"color":     discordStatusColor,
+		"fields":    fields,
 		"timestamp": time.Now().Format(time.RFC3339),
 	}
 
@@ -236,7 +576,7 @@ func (d *DiscordClient) SendStatus(totalListings, newListings int, sampleListing
 		return fmt.Errorf("failed to marshal status payload: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", d.statusWebhookURL, bytes.NewBuffer(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", statusWebhookURL, bytes.NewBuffer(jsonBody))
 	if err != nil {
 		return fmt.Errorf("failed to create status request: %w", err)
 	}
@@ -251,3 +591,75 @@ func (d *DiscordClient) SendStatus(totalListings, newListings int, sampleListing
 
 	return nil
 }
+
+// formatPrice renders a listing's price as monthly rent or asking price
+func formatPrice(listing Listing) string {
+	if listing.IsSale() {
+		return formatDollars(listing.Price)
+	}
+	return fmt.Sprintf("$%d/mo", listing.Price)
+}
+
+// formatDollars renders a whole dollar amount with thousands separators
+func formatDollars(amount int) string {
+	digits := fmt.Sprintf("%d", amount)
+	if amount < 0 {
+		digits = digits[1:]
+	}
+
+	var out []byte
+	for i := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			out = append(out, ',')
+		}
+		out = append(out, digits[i])
+	}
+
+	if amount < 0 {
+		return "-$" + string(out)
+	}
+	return "$" + string(out)
+}
+
+// detailFields builds embed fields for the most useful detail page data
+func detailFields(details *ListingDetails) []map[string]interface{} {
+	var fields []map[string]interface{}
+	add := func(name, value string, inline bool) {
+		fields = append(fields, map[string]interface{}{
+			"name":   name,
+			"value":  value,
+			"inline": inline,
+		})
+	}
+
+	if details.SquareFeet > 0 {
+		add("Size", fmt.Sprintf("%d ft²", details.SquareFeet), true)
+	}
+	if details.NoFee {
+		add("Fee", "No Fee", true)
+	}
+	if details.AvailableAt != "" {
+		add("Available", details.AvailableAt, true)
+	}
+	if details.Concessions != "" {
+		add("Concessions", truncate(details.Concessions, discordFieldLimit), false)
+	}
+	if len(details.Amenities) > 0 {
+		amenities := details.Amenities
+		if len(amenities) > 8 {
+			amenities = amenities[:8]
+		}
+		add("Amenities", truncate(strings.Join(amenities, ", "), discordFieldLimit), false)
+	}
+
+	return fields
+}
+
+// truncate shortens text to at most n runes, adding an ellipsis when cut
+func truncate(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n-1]) + "…"
+}
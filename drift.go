@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// minDriftSample is the fewest listings a poll needs before rates are judged
+	minDriftSample = 10
+
+	// requiredFieldFloor is the population rate below which a required field
+	// is considered broken
+	requiredFieldFloor = 0.95
+
+	// driftSpikeDrop is how far a field's population rate may fall below its
+	// baseline before it counts as a spike of zero values
+	driftSpikeDrop = 0.3
+
+	// driftBaselineAlpha weights the newest poll in the moving baseline
+	driftBaselineAlpha = 0.3
+
+	// driftWarmupPolls is how many polls build a baseline before spikes are judged
+	driftWarmupPolls = 3
+)
+
+// driftField is a listing field whose population rate is tracked. Listings
+// missing a required field are never notified. Counts can legitimately be
+// zero (a studio has no bedrooms), so they are populated when the raw node
+// has a value for them rather than when they are non-zero.
+type driftField struct {
+	name      string
+	required  bool
+	populated func(Listing) bool
+}
+
+var driftFields = []driftField{
+	{"id", true, func(l Listing) bool { return l.ID != "" }},
+	{"price", true, func(l Listing) bool { return l.Price > 0 }},
+	{"street", true, func(l Listing) bool { return l.Street != "" }},
+	{"urlPath", true, func(l Listing) bool { return l.URLPath != "" }},
+	{"areaName", false, func(l Listing) bool { return l.AreaName != "" }},
+	{"bedroomCount", false, func(l Listing) bool { return hasRawField(l, "bedroomCount", l.BedroomCount > 0) }},
+	{"fullBathroomCount", false, func(l Listing) bool { return hasRawField(l, "fullBathroomCount", l.FullBathroomCount > 0) }},
+	{"buildingType", false, func(l Listing) bool { return l.BuildingType != "" }},
+	{"status", false, func(l Listing) bool { return l.Status != "" }},
+	{"geoPoint", false, func(l Listing) bool { return l.HasCoordinates() }},
+}
+
+// DriftReport is the outcome of checking one poll's listings
+type DriftReport struct {
+	Problems []string
+
+	// Scopes holds the problems found in each scope the poll could judge,
+	// keyed like the baselines: the kind for field checks and kind.search for
+	// population rates. A judged scope with no problems maps to nil.
+	Scopes map[string][]string
+
+	// spiking holds the optional fields, keyed by driftKey, whose zero values
+	// are suspect this poll
+	spiking map[string]bool
+}
+
+// Drifted reports whether anything looked wrong
+func (r *DriftReport) Drifted() bool {
+	return len(r.Problems) > 0
+}
+
+// Suspicious reports whether a listing should be held back from notification:
+// it is missing a required field, or is zero in a field that spiked this poll
+func (r *DriftReport) Suspicious(listing Listing) bool {
+	for _, field := range driftFields {
+		if field.populated(listing) {
+			continue
+		}
+		if field.required || r.spiking[driftKey(listing, field.name)] {
+			return true
+		}
+	}
+	return false
+}
+
+// Signature identifies the set of problems in a scope, so repeats can be
+// told apart from new drift
+func (r *DriftReport) Signature(scope string) string {
+	return strings.Join(r.Scopes[scope], "\n")
+}
+
+// observe records the problems found in a judged scope
+func (r *DriftReport) observe(scope string, problems []string) {
+	r.Problems = append(r.Problems, problems...)
+	r.Scopes[scope] = problems
+}
+
+// DriftDetector watches one source's listings for signs its schema changed.
+// Field sets are checked per kind; population rates are tracked per search,
+// since searches run on their own schedules and differ in what they return.
+type DriftDetector struct {
+	mu        sync.Mutex
+	fields    map[ListingKind][]string
+	baselines map[string]float64
+	polls     map[string]int
+}
+
+// NewDriftDetector creates a detector with no baseline. fields lists the
+// raw node fields expected per kind; with none, only population rates are checked.
+func NewDriftDetector(fields map[ListingKind][]string) *DriftDetector {
+	return &DriftDetector{
+		fields:    fields,
+		baselines: make(map[string]float64),
+		polls:     make(map[string]int),
+	}
+}
+
+// Observe checks a poll's listings for missing or unknown fields and for
+// drops in field population rates. Baselines only learn from clean polls.
+func (d *DriftDetector) Observe(listings []Listing) *DriftReport {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	report := &DriftReport{Scopes: make(map[string][]string), spiking: make(map[string]bool)}
+
+	byKind := make(map[ListingKind][]Listing)
+	for _, listing := range listings {
+		kind := listing.Kind
+		if kind == "" {
+			kind = ListingKindRental
+		}
+		byKind[kind] = append(byKind[kind], listing)
+	}
+
+	kinds := make([]string, 0, len(byKind))
+	for kind := range byKind {
+		kinds = append(kinds, string(kind))
+	}
+	sort.Strings(kinds)
+
+	for _, k := range kinds {
+		kind := ListingKind(k)
+		schemaProblems, checked := checkNodeFields(kind, d.fields[kind], byKind[kind])
+		if checked {
+			report.observe(k, schemaProblems)
+		}
+
+		bySearch := make(map[string][]Listing)
+		for _, listing := range byKind[kind] {
+			bySearch[listing.SearchName] = append(bySearch[listing.SearchName], listing)
+		}
+		searches := make([]string, 0, len(bySearch))
+		for search := range bySearch {
+			searches = append(searches, search)
+		}
+		sort.Strings(searches)
+
+		for _, search := range searches {
+			d.observeRates(report, kind, search, bySearch[search], len(schemaProblems) == 0)
+		}
+	}
+
+	return report
+}
+
+// observeRates checks one search's population rates against its baseline,
+// updating the baseline when the poll is clean
+func (d *DriftDetector) observeRates(report *DriftReport, kind ListingKind, search string, group []Listing, clean bool) {
+	if len(group) < minDriftSample {
+		return
+	}
+
+	scope := string(kind) + "." + search
+	var problems []string
+	rates := make(map[string]float64)
+	for _, field := range driftFields {
+		populated := 0
+		for _, listing := range group {
+			if field.populated(listing) {
+				populated++
+			}
+		}
+		rate := float64(populated) / float64(len(group))
+		rates[field.name] = rate
+
+		key := scope + "." + field.name
+		baseline, known := d.baselines[key]
+		switch {
+		case field.required && rate < requiredFieldFloor:
+			problems = append(problems, fmt.Sprintf(
+				"%s %s populated in only %.0f%% of %d listings for search %q", kind, field.name, rate*100, len(group), search))
+			clean = false
+		case !field.required && known && d.polls[scope] >= driftWarmupPolls && baseline-rate >= driftSpikeDrop:
+			problems = append(problems, fmt.Sprintf(
+				"%s %s populated in %.0f%% of listings for search %q, down from a usual %.0f%%", kind, field.name, rate*100, search, baseline*100))
+			report.spiking[key] = true
+			clean = false
+		}
+	}
+	report.observe(scope, problems)
+
+	if clean {
+		for name, rate := range rates {
+			key := scope + "." + name
+			if baseline, known := d.baselines[key]; known {
+				d.baselines[key] = baseline + driftBaselineAlpha*(rate-baseline)
+			} else {
+				d.baselines[key] = rate
+			}
+		}
+		d.polls[scope]++
+	}
+}
+
+// driftKey identifies a field's baseline for the kind and search a listing came from
+func driftKey(listing Listing, field string) string {
+	kind := listing.Kind
+	if kind == "" {
+		kind = ListingKindRental
+	}
+	return string(kind) + "." + listing.SearchName + "." + field
+}
+
+// hasRawField reports whether a listing's raw node has a non-null value for
+// key. Listings without a raw node fall back to the parsed value.
+func hasRawField(listing Listing, key string, fallback bool) bool {
+	if len(listing.Raw) == 0 {
+		return fallback
+	}
+	var node map[string]json.RawMessage
+	if err := json.Unmarshal(listing.Raw, &node); err != nil {
+		return fallback
+	}
+	value, ok := node[key]
+	return ok && string(value) != "null"
+}
+
+// checkNodeFields compares the raw node keys against the fields we asked
+// for. It reports whether there were any raw nodes to check.
+func checkNodeFields(kind ListingKind, fields []string, listings []Listing) (problems []string, checked bool) {
+	if len(fields) == 0 {
+		return nil, false
+	}
+
+	expected := make(map[string]bool)
+	for _, name := range fields {
+		expected[name] = true
+	}
+
+	seen := make(map[string]int)
+	decoded := 0
+	for _, listing := range listings {
+		if len(listing.Raw) == 0 {
+			continue
+		}
+		var node map[string]json.RawMessage
+		if err := json.Unmarshal(listing.Raw, &node); err != nil {
+			continue
+		}
+		decoded++
+		for key := range node {
+			seen[key]++
+		}
+	}
+	if decoded == 0 {
+		return nil, false
+	}
+
+	var missing, unknown []string
+	for _, name := range fields {
+		if seen[name] == 0 {
+			missing = append(missing, name)
+		}
+	}
+	for key := range seen {
+		if !expected[key] && key != "__typename" {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(unknown)
+
+	if len(missing) > 0 {
+		problems = append(problems, fmt.Sprintf("%s nodes are missing field(s): %s", kind, strings.Join(missing, ", ")))
+	}
+	if len(unknown) > 0 {
+		problems = append(problems, fmt.Sprintf("%s nodes have unknown field(s): %s", kind, strings.Join(unknown, ", ")))
+	}
+	return problems, true
+}
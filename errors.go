@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrorCategory classifies why a request to a listing source failed
+type ErrorCategory string
+
+const (
+	ErrorCategoryNetwork     ErrorCategory = "network"
+	ErrorCategoryRateLimited ErrorCategory = "rate_limited"
+	ErrorCategoryBlocked     ErrorCategory = "blocked"
+	ErrorCategoryBadResponse ErrorCategory = "bad_response"
+	ErrorCategoryGraphQL     ErrorCategory = "graphql"
+)
+
+// maxErrorBodyLength caps how much of a response body ends up in an error
+const maxErrorBodyLength = 200
+
+// SourceError is a categorized failure talking to a listing source. Every
+// source returns it, so the poller handles their failures the same way.
+type SourceError struct {
+	Category   ErrorCategory
+	StatusCode int
+	RetryAfter time.Duration
+	Message    string
+	Err        error
+}
+
+// Error implements error
+func (e *SourceError) Error() string {
+	msg := fmt.Sprintf("%s: %s", e.Category, e.Message)
+	if e.Err != nil {
+		msg = fmt.Sprintf("%s: %v", msg, e.Err)
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// Transient reports whether retrying the same request may succeed
+func (e *SourceError) Transient() bool {
+	switch e.Category {
+	case ErrorCategoryNetwork, ErrorCategoryRateLimited:
+		return true
+	case ErrorCategoryBadResponse:
+		return e.StatusCode >= 500
+	default:
+		return false
+	}
+}
+
+// CategoryOf returns the category of a source error, or "" for other errors
+func CategoryOf(err error) ErrorCategory {
+	var srcErr *SourceError
+	if errors.As(err, &srcErr) {
+		return srcErr.Category
+	}
+	return ""
+}
+
+// IsTransient reports whether err is a source error worth retrying
+func IsTransient(err error) bool {
+	var srcErr *SourceError
+	return errors.As(err, &srcErr) && srcErr.Transient()
+}
+
+// statusError builds the categorized error for a non-200 response from a source
+func statusError(source string, resp *http.Response, body []byte) *SourceError {
+	srcErr := &SourceError{
+		Category:   ErrorCategoryBadResponse,
+		StatusCode: resp.StatusCode,
+		Message:    fmt.Sprintf("API returned status %d: %s", resp.StatusCode, truncate(strings.TrimSpace(string(body)), maxErrorBodyLength)),
+	}
+
+	if kind := blockPageKind(resp, body); kind != "" {
+		srcErr.Category = ErrorCategoryBlocked
+		srcErr.Message = fmt.Sprintf("blocked by %s (status %d, %s)", source, resp.StatusCode, kind)
+		return srcErr
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		srcErr.Category = ErrorCategoryRateLimited
+		srcErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	case http.StatusForbidden:
+		srcErr.Category = ErrorCategoryBlocked
+		srcErr.Message = fmt.Sprintf("blocked by %s (status 403)", source)
+	case http.StatusServiceUnavailable:
+		srcErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	}
+
+	return srcErr
+}
+
+// blockPageMarkers are substrings of bot-protection pages
+var blockPageMarkers = []string{
+	"captcha",
+	"px-captcha",
+	"perimeterx",
+	"access to this page has been denied",
+	"are you a robot",
+	"press & hold",
+}
+
+// blockPageKind reports what kind of block page a response is, or "" if it
+// doesn't look like one. StreetEasy sometimes answers with a captcha page
+// and a 200 status, so this is checked for successful responses too. JSON
+// and XML bodies are the data we asked for and can quote any text, such as
+// a listing description, so only other bodies are checked for markers.
+func blockPageKind(resp *http.Response, body []byte) string {
+	lower := strings.ToLower(string(body))
+	contentType := strings.ToLower(resp.Header.Get("Content-Type"))
+	trimmed := strings.TrimSpace(lower)
+	isHTML := strings.Contains(contentType, "text/html") || strings.HasPrefix(trimmed, "<!doctype html") || strings.HasPrefix(trimmed, "<html")
+	if !isHTML && (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") || strings.HasPrefix(trimmed, "<")) {
+		return ""
+	}
+
+	for _, marker := range blockPageMarkers {
+		if strings.Contains(lower, marker) {
+			return "captcha page"
+		}
+	}
+	if isHTML {
+		return "HTML page instead of data"
+	}
+
+	return ""
+}
+
+// parseRetryAfter reads a Retry-After header in seconds or HTTP-date form
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(at); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// backoff returns the wait before retry attempt n (1-based): exponential
+// with full jitter, at least the server's Retry-After, and never more than
+// maxWait. Callers give up instead when Retry-After exceeds maxWait (see
+// retryAfterTooLong), since a poll sleeping that long holds up every other search.
+func backoff(attempt int, base, maxWait, retryAfter time.Duration) time.Duration {
+	wait := base << (attempt - 1)
+	if wait > maxWait || wait <= 0 {
+		wait = maxWait
+	}
+	wait = time.Duration(rand.Int63n(int64(wait) + 1))
+	if retryAfter > wait {
+		wait = retryAfter
+	}
+	return min(wait, maxWait)
+}
+
+// retryAfterTooLong reports whether the server asked us to wait longer than
+// we are willing to before retrying
+func retryAfterTooLong(err *SourceError, maxWait time.Duration) bool {
+	return err.RetryAfter > maxWait
+}
+
+// retryRequest makes a request with attempt, retrying transient source errors
+// with backoff until maxAttempts have failed. A Retry-After longer than
+// maxWait gives up instead, leaving the request to the next poll. retryNow,
+// if set, can ask for an immediate retry that doesn't count as an attempt.
+func retryRequest(ctx context.Context, source string, maxAttempts int, base, maxWait time.Duration,
+	attempt func() ([]byte, error), retryNow func(*SourceError) bool) ([]byte, error) {
+	for n := 1; ; n++ {
+		body, err := attempt()
+		if err == nil {
+			return body, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		var srcErr *SourceError
+		if !errors.As(err, &srcErr) {
+			return nil, err
+		}
+		if retryNow != nil && retryNow(srcErr) {
+			n--
+			continue
+		}
+
+		if !srcErr.Transient() || n >= maxAttempts {
+			return nil, err
+		}
+		if retryAfterTooLong(srcErr, maxWait) {
+			log.Printf("%s asked us to wait %s before retrying; giving up until the next poll", source, srcErr.RetryAfter.Round(time.Second))
+			return nil, err
+		}
+
+		wait := backoff(n, base, maxWait, srcErr.RetryAfter)
+		log.Printf("%s request failed (attempt %d/%d), retrying in %s: %v",
+			source, n, maxAttempts, wait.Round(time.Millisecond), err)
+		if err := sleepContext(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
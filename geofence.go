@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Geofence is a set of polygons parsed from GeoJSON. A point is inside the
+// geofence when it is inside any of its polygons.
+type Geofence struct {
+	polygons []polygon
+}
+
+// polygon is an outer ring followed by zero or more holes. Each ring is a
+// list of [longitude, latitude] positions, as in GeoJSON.
+type polygon [][][2]float64
+
+// geoJSONObject covers the GeoJSON object types we accept
+type geoJSONObject struct {
+	Type        string            `json:"type"`
+	Coordinates json.RawMessage   `json:"coordinates"`
+	Geometry    *geoJSONObject    `json:"geometry"`
+	Features    []json.RawMessage `json:"features"`
+}
+
+// UnmarshalJSON parses a Polygon, MultiPolygon, Feature or FeatureCollection
+func (g *Geofence) UnmarshalJSON(data []byte) error {
+	polygons, err := parseGeoJSON(data)
+	if err != nil {
+		return err
+	}
+	if len(polygons) == 0 {
+		return errors.New("geofence contains no polygons")
+	}
+	g.polygons = polygons
+	return nil
+}
+
+// LoadGeofenceFile reads a GeoJSON file into a geofence
+func LoadGeofenceFile(path string) (Geofence, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Geofence{}, fmt.Errorf("failed to read geofence file: %w", err)
+	}
+	var g Geofence
+	if err := json.Unmarshal(data, &g); err != nil {
+		return Geofence{}, fmt.Errorf("failed to parse geofence file %s: %w", path, err)
+	}
+	return g, nil
+}
+
+func parseGeoJSON(data []byte) ([]polygon, error) {
+	var obj geoJSONObject
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, fmt.Errorf("invalid GeoJSON: %w", err)
+	}
+
+	switch obj.Type {
+	case "Polygon":
+		var p polygon
+		if err := json.Unmarshal(obj.Coordinates, &p); err != nil {
+			return nil, fmt.Errorf("invalid Polygon coordinates: %w", err)
+		}
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+		return []polygon{p}, nil
+	case "MultiPolygon":
+		var ps []polygon
+		if err := json.Unmarshal(obj.Coordinates, &ps); err != nil {
+			return nil, fmt.Errorf("invalid MultiPolygon coordinates: %w", err)
+		}
+		for _, p := range ps {
+			if err := p.validate(); err != nil {
+				return nil, err
+			}
+		}
+		return ps, nil
+	case "Feature":
+		if obj.Geometry == nil {
+			return nil, errors.New("GeoJSON Feature has no geometry")
+		}
+		geometry, err := json.Marshal(obj.Geometry)
+		if err != nil {
+			return nil, err
+		}
+		return parseGeoJSON(geometry)
+	case "FeatureCollection":
+		var all []polygon
+		for _, feature := range obj.Features {
+			ps, err := parseGeoJSON(feature)
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, ps...)
+		}
+		return all, nil
+	default:
+		return nil, fmt.Errorf("unsupported GeoJSON type %q (want Polygon, MultiPolygon, Feature or FeatureCollection)", obj.Type)
+	}
+}
+
+func (p polygon) validate() error {
+	if len(p) == 0 {
+		return errors.New("polygon has no rings")
+	}
+	for _, ring := range p {
+		if len(ring) < 4 {
+			return errors.New("polygon ring needs at least 4 positions")
+		}
+	}
+	return nil
+}
+
+// Contains reports whether the point lies inside any polygon of the geofence
+func (g *Geofence) Contains(latitude, longitude float64) bool {
+	for _, p := range g.polygons {
+		if p.contains(latitude, longitude) {
+			return true
+		}
+	}
+	return false
+}
+
+// contains reports whether the point is inside the outer ring and outside every hole
+func (p polygon) contains(latitude, longitude float64) bool {
+	if !ringContains(p[0], latitude, longitude) {
+		return false
+	}
+	for _, hole := range p[1:] {
+		if ringContains(hole, latitude, longitude) {
+			return false
+		}
+	}
+	return true
+}
+
+// ringContains is the even-odd ray casting test
+func ringContains(ring [][2]float64, latitude, longitude float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > latitude) != (yj > latitude) &&
+			longitude < (xj-xi)*(latitude-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+)
+
+// headerProfile is a set of browser headers that must be sent together to
+// look like one consistent browser. Firefox and Safari don't send client
+// hints, so their sec-ch-ua fields are empty.
+type headerProfile struct {
+	Name            string
+	UserAgent       string
+	AcceptLanguage  string
+	SecCHUA         string
+	SecCHUAMobile   string
+	SecCHUAPlatform string
+}
+
+// headerProfiles are the browser profiles requests rotate through
+var headerProfiles = []headerProfile{
+	{
+		Name:            "chrome-macos",
+		UserAgent:       userAgent,
+		AcceptLanguage:  "en-US,en;q=0.9",
+		SecCHUA:         `"Chromium";v="142", "Google Chrome";v="142", "Not_A Brand";v="99"`,
+		SecCHUAMobile:   "?0",
+		SecCHUAPlatform: `"macOS"`,
+	},
+	{
+		Name:            "chrome-windows",
+		UserAgent:       "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/142.0.0.0 Safari/537.36",
+		AcceptLanguage:  "en-US,en;q=0.9",
+		SecCHUA:         `"Chromium";v="142", "Google Chrome";v="142", "Not_A Brand";v="99"`,
+		SecCHUAMobile:   "?0",
+		SecCHUAPlatform: `"Windows"`,
+	},
+	{
+		Name:            "edge-windows",
+		UserAgent:       "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/142.0.0.0 Safari/537.36 Edg/142.0.0.0",
+		AcceptLanguage:  "en-US,en;q=0.9",
+		SecCHUA:         `"Chromium";v="142", "Microsoft Edge";v="142", "Not_A Brand";v="99"`,
+		SecCHUAMobile:   "?0",
+		SecCHUAPlatform: `"Windows"`,
+	},
+	{
+		Name:           "firefox-macos",
+		UserAgent:      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:144.0) Gecko/20100101 Firefox/144.0",
+		AcceptLanguage: "en-US,en;q=0.5",
+	},
+	{
+		Name:           "safari-macos",
+		UserAgent:      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/26.0 Safari/605.1.15",
+		AcceptLanguage: "en-US,en;q=0.9",
+	},
+}
+
+// apply sets the profile's headers on a request
+func (p headerProfile) apply(header http.Header) {
+	header.Set("User-Agent", p.UserAgent)
+	header.Set("Accept-Language", p.AcceptLanguage)
+	if p.SecCHUA != "" {
+		header.Set("sec-ch-ua", p.SecCHUA)
+		header.Set("sec-ch-ua-mobile", p.SecCHUAMobile)
+		header.Set("sec-ch-ua-platform", p.SecCHUAPlatform)
+	}
+}
+
+// headerProfileNames lists the names of the bundled profiles
+func headerProfileNames() []string {
+	names := make([]string, len(headerProfiles))
+	for i, p := range headerProfiles {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// containsProfile reports whether profiles includes one with the given name
+func containsProfile(profiles []headerProfile, name string) bool {
+	for _, p := range profiles {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// selectHeaderProfiles returns the named profiles, or all when names is empty
+func selectHeaderProfiles(names []string) ([]headerProfile, []string) {
+	if len(names) == 0 {
+		return headerProfiles, nil
+	}
+
+	var selected []headerProfile
+	var unknown []string
+	for _, name := range names {
+		found := false
+		for _, p := range headerProfiles {
+			if p.Name == name {
+				selected = append(selected, p)
+				found = true
+				break
+			}
+		}
+		if !found {
+			unknown = append(unknown, name)
+		}
+	}
+	return selected, unknown
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultOffMarketAfter is how many clean polls a listing may be missing
+// from before it counts as off the market
+const defaultOffMarketAfter = 3
+
+// Lifecycle states stored for each seen listing
+const (
+	LifecycleActive      = "active"
+	LifecycleDisappeared = "disappeared"
+	LifecycleRented      = "rented"
+	LifecycleSold        = "sold"
+)
+
+// Lifecycle events recorded in listing_events
+const (
+	EventOffMarket    = "off_market"
+	EventClosed       = "closed"
+	EventBackOnMarket = "back_on_market"
+)
+
+// LifecycleChange describes a seen listing moving between lifecycle states
+type LifecycleChange struct {
+	ListingID string
+	Kind      ListingKind
+	From      string
+	To        string
+
+	// OffMarketAt is when a listing coming back had left the market
+	OffMarketAt time.Time
+
+	// TimeOnMarket is the total time the listing has been active
+	TimeOnMarket time.Duration
+}
+
+// closedState returns the lifecycle state a listing's API status puts it
+// in, or "" if the status doesn't say it is taken. Searches only ask for
+// active listings, so the status is looked up once a listing has dropped out
+// of them; anything but active means it was rented, sold or went into contract.
+func closedState(kind ListingKind, status string) string {
+	status = strings.ToUpper(strings.TrimSpace(status))
+	if status == "" || status == "ACTIVE" {
+		return ""
+	}
+	if kind == ListingKindSale {
+		return LifecycleSold
+	}
+	return LifecycleRented
+}
+
+// parseOffMarketAfter parses OFF_MARKET_AFTER_POLLS
+func parseOffMarketAfter(value string) (int, error) {
+	if value == "" {
+		return defaultOffMarketAfter, nil
+	}
+	polls, err := strconv.Atoi(value)
+	if err != nil || polls < 1 {
+		return 0, fmt.Errorf("must be a whole number of polls of at least 1, got %q", value)
+	}
+	return polls, nil
+}
+
+// formatDays renders a duration as a rough day count for messages
+func formatDays(d time.Duration) string {
+	days := int(d.Hours()/24 + 0.5)
+	switch {
+	case d < 90*time.Minute:
+		return "1 hour"
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%d hours", int(d.Hours()+0.5))
+	case days == 1:
+		return "1 day"
+	default:
+		return fmt.Sprintf("%d days", days)
+	}
+}
@@ -1,17 +1,28 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
-
-	"github.com/robfig/cron/v3"
 )
 
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "areas":
+			os.Exit(runAreasCommand(os.Args[2:]))
+		case "validate":
+			os.Exit(runValidateCommand(os.Args[2:]))
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown command %q. Available commands: areas, validate\n", os.Args[1])
+			os.Exit(2)
+		}
+	}
+
 	log.Println("NYC Apartment Notifier starting...")
 
 	// Load configuration
@@ -19,7 +30,7 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
-	log.Printf("Config loaded. Database path: %s", cfg.DatabasePath)
+	log.Printf("Config loaded. Database path: %s, %d search(es)", cfg.DatabasePath, len(cfg.Searches))
 
 	// Initialize storage
 	storage, err := NewStorage(cfg.DatabasePath)
@@ -28,86 +39,117 @@ func main() {
 	}
 	defer storage.Close()
 	log.Println("Database initialized")
+	if err := storage.ForgetSearches(context.Background(), searchNames(cfg.Searches)); err != nil {
+		log.Printf("Error forgetting removed searches: %v", err)
+	}
 
 	// Initialize clients
-	streetEasyClient := NewStreetEasyClient()
-	discordClient := NewDiscordClient(cfg.DiscordWebhookURL, cfg.DiscordErrorWebhookURL, cfg.DiscordStatusWebhookURL)
-
-	// Create poll function
-	poll := func() {
-		log.Println("Starting poll...")
+	streetEasyClient := NewStreetEasyClient(cfg.StreetEasyProxies, cfg.HeaderProfiles)
+	if len(cfg.StreetEasyProxies) > 0 {
+		log.Printf("Rotating StreetEasy requests through %d proxies", len(cfg.StreetEasyProxies))
+	}
+	router := NewWebhookRouter(cfg.DiscordWebhookURL, cfg.Searches, cfg.Routes)
+	discordClient := NewDiscordClient(router, cfg.DiscordErrorWebhookURL, cfg.DiscordStatusWebhookURL)
 
-		listings, err := streetEasyClient.FetchListings()
-		if err != nil {
-			log.Printf("Error fetching listings: %v", err)
-			discordClient.SendError(fmt.Sprintf("Failed to fetch listings: %v", err))
-			return
-		}
-		log.Printf("Fetched %d total listings", len(listings))
-
-		newCount := 0
-		for _, listing := range listings {
-			isNew, err := storage.IsNew(listing.ID)
-			if err != nil {
-				log.Printf("Error checking listing %s: %v", listing.ID, err)
-				discordClient.SendError(fmt.Sprintf("Error checking listing %s: %v", listing.ID, err))
-				continue
-			}
+	craigslistClient := NewCraigslistClient(cfg.Areas)
 
-			if isNew {
-				// Send Discord notification
-				if err := discordClient.SendListing(listing); err != nil {
-					log.Printf("Error sending Discord notification for %s: %v", listing.ID, err)
-					discordClient.SendError(fmt.Sprintf("Error sending notification for %s: %v", listing.ID, err))
-					continue
-				}
-
-				// Mark as seen
-				if err := storage.MarkSeen(listing); err != nil {
-					log.Printf("Error marking listing %s as seen: %v", listing.ID, err)
-					discordClient.SendError(fmt.Sprintf("Error marking listing %s as seen: %v", listing.ID, err))
-					continue
-				}
-
-				log.Printf("New listing: %s, %s - $%d/mo (%s)",
-					listing.Street, listing.Unit, listing.Price, listing.AreaName)
-				newCount++
-
-				// Rate limit: wait 500ms between Discord messages
-				time.Sleep(500 * time.Millisecond)
-			}
-		}
+	poller := NewPoller(storage, []ListingSource{streetEasyClient, craigslistClient}, discordClient, cfg.PollerOptions())
 
-		log.Printf("Poll complete. Found %d new listings.", newCount)
+	// Polls run under ctx, which is cancelled if shutdown outlasts the grace period
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-		// Send status update
-		if err := discordClient.SendStatus(len(listings), newCount, listings); err != nil {
-			log.Printf("Error sending status update: %v", err)
-			discordClient.SendError(fmt.Sprintf("Error sending status update: %v", err))
-		}
-	}
+	// Listen for signals before polling so shutdown can interrupt the first poll
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
 	// Run poll immediately on startup
 	log.Println("Running initial poll...")
-	poll()
+	go poller.Poll(ctx, cfg.Searches)
 
-	// Set up cron scheduler for every 30 minutes
-	c := cron.New()
-	_, err = c.AddFunc("*/30 * * * *", poll)
+	// Set up a cron entry per search on its own schedule
+	c, err := buildScheduler(ctx, cfg, poller)
 	if err != nil {
-		discordClient.SendError(fmt.Sprintf("Failed to add cron job: %v", err))
-		log.Fatalf("Failed to add cron job: %v", err)
+		discordClient.SendError(ctx, err.Error())
+		log.Fatalf("Failed to set up scheduler: %v", err)
 	}
 	c.Start()
-	log.Println("Scheduler started. Polling every 30 minutes.")
+	log.Println("Scheduler started.")
+
+	// Optionally watch the config file for changes. The path and interval
+	// are fixed at startup; a reload that sees them changed only logs it.
+	configChanged := make(chan struct{}, 1)
+	if cfg.ConfigPath != "" && cfg.ConfigReloadInterval > 0 {
+		go watchConfigFile(cfg.ConfigPath, cfg.ConfigReloadInterval, configChanged)
+		log.Printf("Watching %s for changes every %s", cfg.ConfigPath, cfg.ConfigReloadInterval)
+	}
 
-	// Wait for shutdown signal
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	// reload re-reads the config and swaps it in, keeping the old one on error
+	reload := func(reason string) {
+		log.Printf("Reloading config (%s)...", reason)
+
+		newCfg, err := LoadConfig()
+		if err != nil {
+			log.Printf("Config reload failed, keeping previous config: %v", err)
+			discordClient.SendError(ctx, fmt.Sprintf("Config reload failed, keeping previous config: %v", err))
+			return
+		}
+
+		newCron, err := buildScheduler(ctx, newCfg, poller)
+		if err != nil {
+			log.Printf("Config reload failed, keeping previous config: %v", err)
+			discordClient.SendError(ctx, fmt.Sprintf("Config reload failed, keeping previous config: %v", err))
+			return
+		}
+
+		if newCfg.DatabasePath != cfg.DatabasePath {
+			log.Printf("DATABASE_PATH changed to %s; restart to apply", newCfg.DatabasePath)
+		}
+		if newCfg.ConfigPath != cfg.ConfigPath {
+			log.Printf("CONFIG_PATH changed to %s; restart to watch it", newCfg.ConfigPath)
+		}
+		if newCfg.ConfigReloadInterval != cfg.ConfigReloadInterval {
+			log.Printf("CONFIG_RELOAD_INTERVAL changed to %s; restart to apply", newCfg.ConfigReloadInterval)
+		}
 
-	sig := <-sigChan
-	log.Printf("Received signal %v, shutting down...", sig)
+		c.Stop()
+		discordClient.Reconfigure(
+			NewWebhookRouter(newCfg.DiscordWebhookURL, newCfg.Searches, newCfg.Routes),
+			newCfg.DiscordErrorWebhookURL,
+			newCfg.DiscordStatusWebhookURL,
+		)
+		streetEasyClient.Reconfigure(newCfg.StreetEasyProxies, newCfg.HeaderProfiles)
+		craigslistClient.Reconfigure(newCfg.Areas)
+		poller.Reconfigure(newCfg.PollerOptions())
+		if err := storage.ForgetSearches(ctx, searchNames(newCfg.Searches)); err != nil {
+			log.Printf("Error forgetting removed searches: %v", err)
+		}
+		newCron.Start()
+		c = newCron
+		cfg = newCfg
 
-	c.Stop()
-	log.Println("Scheduler stopped. Goodbye!")
+		log.Printf("Config reloaded. %d search(es)", len(cfg.Searches))
+	}
+
+	// Wait for shutdown signal, reloading on SIGHUP
+	for {
+		select {
+		case sig := <-sigChan:
+			if sig == syscall.SIGHUP {
+				reload("SIGHUP")
+				continue
+			}
+			log.Printf("Received signal %v, shutting down...", sig)
+			c.Stop()
+			log.Printf("Scheduler stopped. Waiting up to %s for the running poll...", cfg.ShutdownGracePeriod)
+			if poller.Shutdown(cfg.ShutdownGracePeriod, cancel) {
+				log.Println("Poll finished. Goodbye!")
+			} else {
+				log.Println("Grace period expired; cancelled the running poll. Goodbye!")
+			}
+			return
+		case <-configChanged:
+			reload("config file changed")
+		}
+	}
 }
@@ -1,27 +1,83 @@
 package main
 
-// Listing represents an apartment listing from StreetEasy
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ListingKind distinguishes rentals from sales
+type ListingKind string
+
+const (
+	ListingKindRental ListingKind = "rental"
+	ListingKindSale   ListingKind = "sale"
+)
+
+// Listing represents an apartment listing from a listing source. Price is
+// the monthly rent for rentals and the asking price for sales.
 type Listing struct {
 	ID                string
+	Kind              ListingKind
 	AreaName          string
 	BedroomCount      int
 	BuildingType      string
 	FullBathroomCount int
 	HalfBathroomCount int
+	Latitude          float64
+	Longitude         float64
 	PhotoKey          string
 	Price             int
+	Maintenance       int
+	CommonCharges     int
+	Taxes             int
 	SourceGroupLabel  string
 	Status            string
 	Street            string
 	Unit              string
+	NormalizedStreet  string
+	UnitInfo          UnitInfo
 	URLPath           string
+	Tier              string
+	RelloCTAEnabled   bool
+	RelloLink         string
+	RelloRentalID     string
+	Headline          string
+	Source            string
+	SearchName        string
+	SearchCriteria    string
+	Details           *ListingDetails
+	Raw               json.RawMessage
+}
+
+// HasCoordinates reports whether the listing has a known location
+func (l *Listing) HasCoordinates() bool {
+	return l.Latitude != 0 || l.Longitude != 0
+}
+
+// IsSale reports whether the listing is for sale rather than for rent
+func (l *Listing) IsSale() bool {
+	return l.Kind == ListingKindSale
+}
+
+// URL returns the listing page
+func (l *Listing) URL() string {
+	return listingURL(l.URLPath)
+}
+
+// listingURL builds a listing page URL. urlPath is a StreetEasy path unless
+// the source gave a full URL.
+func listingURL(urlPath string) string {
+	if strings.HasPrefix(urlPath, "http://") || strings.HasPrefix(urlPath, "https://") {
+		return urlPath
+	}
+	return "https://streeteasy.com" + urlPath
 }
 
 // GraphQL response structures
 
 type GraphQLResponse struct {
-	Data   *ResponseData   `json:"data"`
-	Errors []GraphQLError  `json:"errors,omitempty"`
+	Data   *ResponseData  `json:"data"`
+	Errors []GraphQLError `json:"errors,omitempty"`
 }
 
 type GraphQLError struct {
@@ -31,31 +87,107 @@ type GraphQLError struct {
 
 type ResponseData struct {
 	SearchRentals SearchRentalsResult `json:"searchRentals"`
+	SearchSales   SearchSalesResult   `json:"searchSales"`
 }
 
 type SearchRentalsResult struct {
-	TotalCount int    `json:"totalCount"`
-	Edges      []Edge `json:"edges"`
+	Search     *SearchInfo `json:"search"`
+	TotalCount int         `json:"totalCount"`
+	Edges      []Edge      `json:"edges"`
 }
 
+// SearchInfo echoes back the criteria the API applied
+type SearchInfo struct {
+	Criteria json.RawMessage `json:"criteria"`
+}
+
+// CriteriaString returns the criteria as text, unquoting JSON strings
+func (s *SearchInfo) CriteriaString() string {
+	if s == nil || len(s.Criteria) == 0 || string(s.Criteria) == "null" {
+		return ""
+	}
+	var text string
+	if err := json.Unmarshal(s.Criteria, &text); err == nil {
+		return text
+	}
+	return string(s.Criteria)
+}
+
+// SearchSalesResult has the same shape as SearchRentalsResult
+type SearchSalesResult = SearchRentalsResult
+
 type Edge struct {
 	Node *ListingNode `json:"node"`
 }
 
+// UnmarshalJSON decodes the node while keeping its raw JSON
+func (e *Edge) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Node json.RawMessage `json:"node"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw.Node) == 0 || string(raw.Node) == "null" {
+		return nil
+	}
+
+	var node ListingNode
+	if err := json.Unmarshal(raw.Node, &node); err != nil {
+		return err
+	}
+	node.Raw = raw.Node
+	e.Node = &node
+	return nil
+}
+
 type ListingNode struct {
-	ID                string     `json:"id"`
-	AreaName          string     `json:"areaName"`
-	BedroomCount      int        `json:"bedroomCount"`
-	BuildingType      string     `json:"buildingType"`
-	FullBathroomCount int        `json:"fullBathroomCount"`
-	HalfBathroomCount int        `json:"halfBathroomCount"`
-	LeadMedia         *LeadMedia `json:"leadMedia"`
-	Price             int        `json:"price"`
-	SourceGroupLabel  string     `json:"sourceGroupLabel"`
-	Status            string     `json:"status"`
-	Street            string     `json:"street"`
-	Unit              string     `json:"unit"`
-	URLPath           string     `json:"urlPath"`
+	ID                string        `json:"id"`
+	AreaName          string        `json:"areaName"`
+	BedroomCount      int           `json:"bedroomCount"`
+	BuildingType      string        `json:"buildingType"`
+	FullBathroomCount int           `json:"fullBathroomCount"`
+	GeoPoint          *GeoPoint     `json:"geoPoint"`
+	HalfBathroomCount int           `json:"halfBathroomCount"`
+	LeadMedia         *LeadMedia    `json:"leadMedia"`
+	Price             int           `json:"price"`
+	Maintenance       int           `json:"maintenance"`
+	CommonCharges     int           `json:"commonCharges"`
+	Taxes             int           `json:"taxes"`
+	SourceGroupLabel  string        `json:"sourceGroupLabel"`
+	Status            string        `json:"status"`
+	Street            string        `json:"street"`
+	Unit              string        `json:"unit"`
+	URLPath           string        `json:"urlPath"`
+	Tier              string        `json:"tier"`
+	RelloExpress      *RelloExpress `json:"relloExpress"`
+
+	// Raw is the node as returned by the API
+	Raw json.RawMessage `json:"-"`
+}
+
+type RelloExpress struct {
+	CTAEnabled bool           `json:"ctaEnabled"`
+	Link       string         `json:"link"`
+	RentalID   flexibleString `json:"rentalId"`
+}
+
+// flexibleString decodes a JSON string or number as a string
+type flexibleString string
+
+// UnmarshalJSON accepts strings, numbers and null
+func (f *flexibleString) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*f = ""
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*f = flexibleString(text)
+		return nil
+	}
+	*f = flexibleString(strings.TrimSpace(string(data)))
+	return nil
 }
 
 type LeadMedia struct {
@@ -73,19 +205,45 @@ func (n *ListingNode) ToListing() Listing {
 		photoKey = n.LeadMedia.Photo.Key
 	}
 
-	return Listing{
+	var relloCTAEnabled bool
+	var relloLink, relloRentalID string
+	if n.RelloExpress != nil {
+		relloCTAEnabled = n.RelloExpress.CTAEnabled
+		relloLink = n.RelloExpress.Link
+		relloRentalID = string(n.RelloExpress.RentalID)
+	}
+
+	var latitude, longitude float64
+	if n.GeoPoint != nil {
+		latitude = n.GeoPoint.Latitude
+		longitude = n.GeoPoint.Longitude
+	}
+
+	listing := Listing{
 		ID:                n.ID,
 		AreaName:          n.AreaName,
 		BedroomCount:      n.BedroomCount,
 		BuildingType:      n.BuildingType,
 		FullBathroomCount: n.FullBathroomCount,
 		HalfBathroomCount: n.HalfBathroomCount,
+		Latitude:          latitude,
+		Longitude:         longitude,
 		PhotoKey:          photoKey,
 		Price:             n.Price,
+		Maintenance:       n.Maintenance,
+		CommonCharges:     n.CommonCharges,
+		Taxes:             n.Taxes,
 		SourceGroupLabel:  n.SourceGroupLabel,
 		Status:            n.Status,
 		Street:            n.Street,
 		Unit:              n.Unit,
 		URLPath:           n.URLPath,
+		Tier:              n.Tier,
+		RelloCTAEnabled:   relloCTAEnabled,
+		RelloLink:         relloLink,
+		RelloRentalID:     relloRentalID,
+		Raw:               n.Raw,
 	}
+	listing.normalizeAddress()
+	return listing
 }
@@ -0,0 +1,728 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// discordMessageInterval is the pause after each Discord message to stay
+// under the webhook rate limit
+const discordMessageInterval = 500 * time.Millisecond
+
+// maxDetailFetchesPerPoll caps detail requests in one poll so a fresh
+// database or a broad new search doesn't burst the source; listings past the
+// cap are notified with cached details or none
+const maxDetailFetchesPerPoll = 20
+
+// PollerOptions are the settings a poll runs with. They can be swapped on
+// config reload.
+type PollerOptions struct {
+	Duplicates DuplicateMode
+	PriceDrop  PriceDropThreshold
+
+	// OffMarketAfter is how many complete polls in a row a listing may be
+	// missing from before it is marked off the market
+	OffMarketAfter int
+}
+
+// Poller runs searches against listing sources, notifies on new listings
+// and records them
+type Poller struct {
+	storage  *Storage
+	sources  []ListingSource
+	discord  *DiscordClient
+	breakers map[string]*CircuitBreaker
+	drift    map[string]*DriftDetector
+
+	// lastDrift holds, per source, the signature of the last drift alert
+	// for each drift scope still drifting, to alert once per change
+	lastDrift map[string]map[string]string
+
+	// mu serializes polls so overlapping schedules don't double-notify
+	mu sync.Mutex
+
+	// stateMu guards closed and opts; inFlight tracks running polls for shutdown
+	stateMu  sync.Mutex
+	closed   bool
+	opts     PollerOptions
+	inFlight sync.WaitGroup
+}
+
+// NewPoller creates a new poller over the given sources. Each source gets
+// its own circuit breaker, and sources with a known schema a drift detector.
+func NewPoller(storage *Storage, sources []ListingSource, discord *DiscordClient, opts PollerOptions) *Poller {
+	p := &Poller{
+		opts:      opts,
+		storage:   storage,
+		sources:   sources,
+		discord:   discord,
+		breakers:  make(map[string]*CircuitBreaker),
+		drift:     make(map[string]*DriftDetector),
+		lastDrift: make(map[string]map[string]string),
+	}
+	for _, source := range sources {
+		p.breakers[source.Name()] = NewCircuitBreaker()
+		if schema, ok := source.(SchemaSource); ok {
+			p.drift[source.Name()] = NewDriftDetector(schema.NodeFields())
+		}
+	}
+	return p
+}
+
+// Poll runs the given searches against their sources and sends
+// notifications for new listings. When ctx is cancelled the poll stops
+// between listings, so every listing that was notified is also marked seen
+// and the rest are picked up next time.
+func (p *Poller) Poll(ctx context.Context, searches []Search) {
+	if !p.begin() {
+		log.Println("Skipping poll: shutting down")
+		return
+	}
+	defer p.inFlight.Done()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Shutdown may have started while we waited for the poll before us
+	if p.isClosed() || ctx.Err() != nil {
+		log.Println("Skipping poll: shutting down")
+		return
+	}
+
+	opts := p.options()
+
+	scope := strings.Join(searchNames(searches), ", ")
+
+	log.Printf("Starting poll (%s)...", scope)
+
+	var listings []Listing
+	var warnings []string
+	var complete []fetchScope
+	for _, search := range searches {
+		for _, sourceName := range search.SourceNames() {
+			if ctx.Err() != nil {
+				break
+			}
+
+			source := p.source(sourceName)
+			if source == nil {
+				warning := fmt.Sprintf("Search %q skipped on %s: source not configured", search.Name, sourceName)
+				log.Print(warning)
+				warnings = append(warnings, warning)
+				continue
+			}
+
+			results, present, fetchWarnings := p.fetch(ctx, source, search)
+			listings = append(listings, results...)
+			warnings = append(warnings, fetchWarnings...)
+			if present != nil {
+				complete = append(complete, fetchScope{source: sourceName, search: search.Name, present: present})
+			}
+		}
+	}
+	log.Printf("Fetched %d total listings", len(listings))
+
+	// Check each source for signs its schema changed under us
+	reports := make(map[string]*DriftReport)
+	for _, group := range groupBySource(listings) {
+		name := group[0].Source
+		detector := p.drift[name]
+		if detector == nil {
+			continue
+		}
+		report := detector.Observe(group)
+		p.reportDrift(ctx, name, report)
+		if report.Drifted() {
+			warnings = append(warnings, fmt.Sprintf("Possible %s schema drift; suspicious listings suppressed", name))
+		}
+		reports[name] = report
+	}
+
+	newCount := 0
+	suppressed := 0
+	duplicates := 0
+	priceDrops := 0
+	backOnMarket := 0
+	detailFetches := 0
+	for i, listing := range listings {
+		if ctx.Err() != nil {
+			log.Printf("Poll cancelled with %d listings left unchecked; they will be picked up next poll", len(listings)-i)
+			break
+		}
+
+		isNew, err := p.storage.IsNew(ctx, listing.ID)
+		if err != nil {
+			log.Printf("Error checking listing %s: %v", listing.ID, err)
+			p.discord.SendError(ctx, fmt.Sprintf("Error checking listing %s: %v", listing.ID, err))
+			continue
+		}
+
+		if report := reports[listing.Source]; report != nil && report.Suspicious(listing) {
+			// Leave a new listing unseen so it is notified once the data
+			// looks right, and keep the last good snapshot of a seen one
+			if isNew {
+				log.Printf("Suppressing suspicious listing %s (price %d, street %q, urlPath %q)",
+					listing.ID, listing.Price, listing.Street, listing.URLPath)
+				suppressed++
+			}
+			continue
+		}
+
+		if !isNew {
+			if p.trackLifecycle(ctx, listing) {
+				backOnMarket++
+			}
+			if p.trackPrice(ctx, listing, opts.PriceDrop) {
+				priceDrops++
+			}
+
+			// Bring the stored snapshot and last-seen time up to date
+			if err := p.storage.MarkSeen(ctx, listing); err != nil {
+				log.Printf("Error updating listing %s: %v", listing.ID, err)
+			}
+			continue
+		}
+
+		if opts.Duplicates != DuplicatesOff {
+			original, err := p.storage.FindDuplicate(ctx, listing)
+			if err != nil {
+				log.Printf("Error checking listing %s for duplicates: %v", listing.ID, err)
+			} else if original != nil {
+				if p.recordDuplicate(ctx, listing, original, opts.Duplicates) {
+					duplicates++
+				}
+				continue
+			}
+		}
+
+		// Fetch or reuse detail page data for the embed
+		if !listing.IsSale() {
+			details, fetched := p.details(ctx, p.source(listing.Source), listing.ID, detailFetches < maxDetailFetchesPerPoll)
+			if fetched {
+				detailFetches++
+			}
+			if details != nil {
+				listing.Details = details
+			}
+		}
+
+		// Send Discord notification
+		if err := p.discord.SendListing(ctx, listing); err != nil {
+			log.Printf("Error sending Discord notification for %s: %v", listing.ID, err)
+			p.discord.SendError(ctx, fmt.Sprintf("Error sending notification for %s: %v", listing.ID, err))
+			continue
+		}
+
+		// Mark as seen even if we're being cancelled, since the
+		// notification already went out
+		if err := p.storage.MarkSeen(context.WithoutCancel(ctx), listing); err != nil {
+			log.Printf("Error marking listing %s as seen: %v", listing.ID, err)
+			p.discord.SendError(ctx, fmt.Sprintf("Error marking listing %s as seen: %v", listing.ID, err))
+			continue
+		}
+		if _, err := p.storage.RecordPrice(context.WithoutCancel(ctx), listing.ID, listing.Price); err != nil {
+			log.Printf("Error recording price for %s: %v", listing.ID, err)
+		}
+
+		log.Printf("New listing [%s/%s]: %s, %s - %s (%s)",
+			listing.Source, listing.SearchName, listing.Street, listing.Unit, formatPrice(listing), listing.AreaName)
+		newCount++
+
+		pace(ctx)
+	}
+
+	if ctx.Err() != nil {
+		log.Printf("Poll cancelled (%s) after %d new listings.", scope, newCount)
+		return
+	}
+
+	offMarket := p.recordAbsences(ctx, complete, opts.OffMarketAfter, maxDetailFetchesPerPoll-detailFetches)
+
+	log.Printf("Poll complete (%s). Found %d new listings, %d duplicates, %d price drops, %d back on market and %d off market.",
+		scope, newCount, duplicates, priceDrops, backOnMarket, offMarket)
+	if suppressed > 0 {
+		warnings = append(warnings, fmt.Sprintf("Suppressed %d suspicious new listing(s)", suppressed))
+	}
+
+	// Send status update
+	if err := p.discord.SendStatus(ctx, scope, len(listings), newCount, listings, warnings); err != nil {
+		log.Printf("Error sending status update: %v", err)
+		p.discord.SendError(ctx, fmt.Sprintf("Error sending status update: %v", err))
+	}
+}
+
+// fetchScope is a source and search whose fetch returned every matching
+// listing, with the IDs it returned
+type fetchScope struct {
+	source  string
+	search  string
+	present map[string]bool
+}
+
+// trackLifecycle records that a seen listing is still listed, notifying when
+// it comes back on the market. It reports whether a back-on-market notice was sent.
+func (p *Poller) trackLifecycle(ctx context.Context, listing Listing) bool {
+	change, err := p.storage.UpdateLifecycle(ctx, listing)
+	if err != nil {
+		log.Printf("Error updating lifecycle for %s: %v", listing.ID, err)
+		return false
+	}
+	if change == nil {
+		return false
+	}
+
+	if err := p.discord.SendBackOnMarket(ctx, listing, change); err != nil {
+		log.Printf("Error sending back-on-market notice for %s: %v", listing.ID, err)
+		p.discord.SendError(ctx, fmt.Sprintf("Error sending back-on-market notice for %s: %v", listing.ID, err))
+		return false
+	}
+
+	log.Printf("Back on market [%s/%s]: %s, %s - %s (was %s)",
+		listing.Source, listing.SearchName, listing.Street, listing.Unit, formatPrice(listing), change.From)
+
+	pace(ctx)
+	return true
+}
+
+// recordAbsences counts a missed poll for listings missing from each
+// complete fetch and marks those gone long enough as off the market. Up to
+// lookups of them have their status looked up, so rented and sold listings
+// are told apart from ones that just disappeared. It returns how many left
+// the market.
+func (p *Poller) recordAbsences(ctx context.Context, scopes []fetchScope, threshold, lookups int) int {
+	if threshold < 1 {
+		threshold = defaultOffMarketAfter
+	}
+
+	offMarket := 0
+	for _, scope := range scopes {
+		changes, err := p.storage.RecordAbsences(ctx, scope.source, scope.search, scope.present, threshold)
+		if err != nil {
+			log.Printf("Error recording absences for search %q on %s: %v", scope.search, scope.source, err)
+			continue
+		}
+		for _, change := range changes {
+			log.Printf("Listing %s [%s/%s] is off the market after %s",
+				change.ListingID, scope.source, scope.search, formatDays(change.TimeOnMarket))
+			if lookups > 0 && p.lookUpClosed(ctx, p.source(scope.source), change) {
+				lookups--
+			}
+		}
+		offMarket += len(changes)
+	}
+	return offMarket
+}
+
+// lookUpClosed asks the source for the status of a listing that left the
+// market and records whether it was rented or sold. It reports whether a
+// request was made. Failures leave the listing disappeared.
+func (p *Poller) lookUpClosed(ctx context.Context, source ListingSource, change LifecycleChange) bool {
+	statusSource, ok := source.(StatusSource)
+	if !ok {
+		return false
+	}
+	if allowed, _ := p.breakers[source.Name()].Allow(); !allowed {
+		return false
+	}
+
+	status, err := statusSource.FetchStatus(ctx, change.ListingID, change.Kind)
+	if err != nil {
+		log.Printf("Error looking up status for %s: %v", change.ListingID, err)
+		if CategoryOf(err) == ErrorCategoryBlocked {
+			p.recordBlocked(ctx, source.Name(), err)
+		}
+		return true
+	}
+
+	state := closedState(change.Kind, status)
+	if state == "" {
+		return true
+	}
+	if _, err := p.storage.MarkClosed(ctx, change.ListingID, state); err != nil {
+		log.Printf("Error marking %s as %s: %v", change.ListingID, state, err)
+		return true
+	}
+	log.Printf("Listing %s is %s (status %s)", change.ListingID, state, status)
+	return true
+}
+
+// trackPrice records a seen listing's price in its history and sends a
+// price-drop notice when it fell by at least the threshold. It reports
+// whether a notice was sent.
+func (p *Poller) trackPrice(ctx context.Context, listing Listing, threshold PriceDropThreshold) bool {
+	previous, err := p.storage.RecordPrice(ctx, listing.ID, listing.Price)
+	if err != nil {
+		log.Printf("Error recording price for %s: %v", listing.ID, err)
+		return false
+	}
+	if !threshold.Notable(previous, listing.Price) {
+		return false
+	}
+
+	if err := p.discord.SendPriceDrop(ctx, listing, previous); err != nil {
+		log.Printf("Error sending price drop for %s: %v", listing.ID, err)
+		p.discord.SendError(ctx, fmt.Sprintf("Error sending price drop for %s: %v", listing.ID, err))
+		return false
+	}
+
+	log.Printf("Price drop [%s/%s]: %s, %s - %s → %s",
+		listing.Source, listing.SearchName, listing.Street, listing.Unit, formatDollars(previous), formatDollars(listing.Price))
+
+	pace(ctx)
+	return true
+}
+
+// recordDuplicate notes (or silently records) a new listing for an apartment
+// already notified as original. It reports whether the listing was handled;
+// if not, it stays unseen and is retried next poll.
+func (p *Poller) recordDuplicate(ctx context.Context, listing Listing, original *SeenListing, mode DuplicateMode) bool {
+	if mode == DuplicatesNote {
+		if err := p.discord.SendDuplicate(ctx, listing, original); err != nil {
+			log.Printf("Error sending duplicate note for %s: %v", listing.ID, err)
+			p.discord.SendError(ctx, fmt.Sprintf("Error sending duplicate note for %s: %v", listing.ID, err))
+			return false
+		}
+	}
+
+	if err := p.storage.MarkSeen(context.WithoutCancel(ctx), listing); err != nil {
+		log.Printf("Error marking listing %s as seen: %v", listing.ID, err)
+		p.discord.SendError(ctx, fmt.Sprintf("Error marking listing %s as seen: %v", listing.ID, err))
+		return false
+	}
+	if _, err := p.storage.RecordPrice(context.WithoutCancel(ctx), listing.ID, listing.Price); err != nil {
+		log.Printf("Error recording price for %s: %v", listing.ID, err)
+	}
+
+	log.Printf("Duplicate listing [%s/%s] %s of %s/%s: %s, %s - %s",
+		listing.Source, listing.SearchName, listing.ID, original.Source, original.ID,
+		listing.Street, listing.Unit, formatPrice(listing))
+
+	if mode == DuplicatesNote {
+		pace(ctx)
+	}
+	return true
+}
+
+// fetch runs one search against one source, returning the listings inside
+// the search's geofences and any warnings for the status update. present
+// holds the ID of every listing the source returned, or is nil when the
+// results may be incomplete. Blocks open the source's circuit breaker; other
+// failures are reported and yield nothing.
+func (p *Poller) fetch(ctx context.Context, source ListingSource, search Search) (listings []Listing, present map[string]bool, warnings []string) {
+	name := source.Name()
+
+	// Don't touch a source while we're blocked
+	breaker := p.breakers[name]
+	allowed, probe := breaker.Allow()
+	if !allowed {
+		log.Printf("Skipping search %q on %s: blocked, next probe at %s",
+			search.Name, name, breaker.OpenUntil().Format(time.Kitchen))
+		return nil, nil, nil
+	}
+	if probe {
+		log.Printf("Probing %s after block (%s)...", name, search.Name)
+	}
+
+	result, err := source.FetchListings(ctx, search)
+	if err != nil {
+		if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+			log.Printf("Fetch for search %q on %s cancelled", search.Name, name)
+			return nil, nil, nil
+		}
+		log.Printf("Error fetching listings for search %q on %s: %v", search.Name, name, err)
+		if CategoryOf(err) == ErrorCategoryBlocked {
+			p.recordBlocked(ctx, name, err)
+			return nil, nil, nil
+		}
+		// Transient failures already exhausted their retries; note them
+		// in the status update rather than paging the error channel
+		if IsTransient(err) {
+			return nil, nil, []string{fmt.Sprintf("Search %q skipped on %s after retries (%s)", search.Name, name, CategoryOf(err))}
+		}
+		p.discord.SendError(ctx, fmt.Sprintf("Failed to fetch listings for search %q on %s: %v", search.Name, name, err))
+		return nil, nil, nil
+	}
+	p.recordSuccess(ctx, name)
+
+	results := result.Listings
+	log.Printf("Fetched %d of %d listings for search %q on %s (%d page(s))",
+		len(results), result.TotalCount, search.Name, name, result.Pages)
+	if result.Truncated {
+		warning := fmt.Sprintf("Search %q truncated on %s: fetched %d of %d listings", search.Name, name, len(results), result.TotalCount)
+		log.Print(warning)
+		warnings = append(warnings, warning)
+	}
+
+	// Absences only count when we hold every listing the source says
+	// matches. A listing filtered out below is still on the market, so
+	// presence counts everything the source returned.
+	if !result.Truncated && !result.Partial && len(results) >= result.TotalCount {
+		present = make(map[string]bool, len(results))
+		for _, listing := range results {
+			present[listing.ID] = true
+		}
+	}
+
+	// Drop listings outside the search's geofences or floor bounds
+	for _, listing := range results {
+		if search.InGeofence(listing) && search.OnFloor(listing) {
+			listings = append(listings, listing)
+		}
+	}
+	if len(listings) < len(results) {
+		log.Printf("Geofence and floor filters excluded %d listings for search %q on %s", len(results)-len(listings), search.Name, name)
+	}
+
+	return listings, present, warnings
+}
+
+// source returns the configured source with the given name, or nil
+func (p *Poller) source(name string) ListingSource {
+	for _, source := range p.sources {
+		if source.Name() == name {
+			return source
+		}
+	}
+	return nil
+}
+
+// groupBySource splits listings by source, keeping first-seen order
+func groupBySource(listings []Listing) [][]Listing {
+	var groups [][]Listing
+	index := make(map[string]int)
+	for _, listing := range listings {
+		i, ok := index[listing.Source]
+		if !ok {
+			i = len(groups)
+			index[listing.Source] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], listing)
+	}
+	return groups
+}
+
+// recordBlocked opens a source's circuit breaker, alerting once when it first opens
+func (p *Poller) recordBlocked(ctx context.Context, source string, err error) {
+	opened, cooldown := p.breakers[source].RecordBlocked()
+	if !opened {
+		log.Printf("Still blocked by %s, backing off for %s", source, cooldown)
+		return
+	}
+
+	log.Printf("Blocked by %s, pausing requests for %s", source, cooldown)
+	p.discord.SendAlert(ctx, fmt.Sprintf("Blocked by %s", source),
+		fmt.Sprintf("%s is blocking our requests (%v).\nPolling it is paused and will probe again in %s, backing off further while the block lasts. You'll get a message when it recovers.", source, err, cooldown),
+		discordErrorColor)
+}
+
+// recordSuccess closes a source's circuit breaker, announcing recovery if it was open
+func (p *Poller) recordSuccess(ctx context.Context, source string) {
+	recovered, blockedFor := p.breakers[source].RecordSuccess()
+	if !recovered {
+		return
+	}
+
+	log.Printf("%s requests recovered after %s", source, blockedFor.Round(time.Minute))
+	p.discord.SendAlert(ctx, fmt.Sprintf("%s Recovered", source),
+		fmt.Sprintf("Requests are succeeding again after being blocked for %s. Polling has resumed.", blockedFor.Round(time.Minute)),
+		discordStatusColor)
+}
+
+// reportDrift alerts when schema drift appears or changes in any of a
+// source's drift scopes, and when scopes clear. Scopes the poll couldn't
+// judge keep their state, since other searches run on their own schedules.
+func (p *Poller) reportDrift(ctx context.Context, source string, report *DriftReport) {
+	state := p.lastDrift[source]
+	if state == nil {
+		state = make(map[string]string)
+		p.lastDrift[source] = state
+	}
+
+	scopes := make([]string, 0, len(report.Scopes))
+	for scope := range report.Scopes {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+
+	var drifted []string
+	var cleared []string
+	for _, scope := range scopes {
+		signature := report.Signature(scope)
+		if signature == state[scope] {
+			continue
+		}
+		if signature == "" {
+			cleared = append(cleared, describeDriftScope(scope))
+			delete(state, scope)
+			continue
+		}
+		drifted = append(drifted, report.Scopes[scope]...)
+		state[scope] = signature
+	}
+
+	if len(drifted) > 0 {
+		for _, problem := range drifted {
+			log.Printf("%s schema drift: %s", source, problem)
+		}
+		p.discord.SendAlert(ctx, fmt.Sprintf("Possible %s Schema Drift", source),
+			fmt.Sprintf("The API response no longer looks like what we expect:\n• %s\n\nListings with missing or suspect values are being held back until this clears.",
+				strings.Join(drifted, "\n• ")),
+			discordErrorColor)
+	}
+
+	if len(cleared) == 0 {
+		return
+	}
+	log.Printf("%s schema drift cleared for %s", source, strings.Join(cleared, ", "))
+	if len(state) == 0 {
+		p.discord.SendAlert(ctx, fmt.Sprintf("%s Schema Drift Cleared", source),
+			"Listing data looks normal again. Suppressed listings will be notified on the next poll.",
+			discordStatusColor)
+		return
+	}
+
+	still := make([]string, 0, len(state))
+	for scope := range state {
+		still = append(still, describeDriftScope(scope))
+	}
+	sort.Strings(still)
+	p.discord.SendAlert(ctx, fmt.Sprintf("%s Schema Drift Partly Cleared", source),
+		fmt.Sprintf("Listing data looks normal again for %s. Still drifting: %s; listings there stay held back.",
+			strings.Join(cleared, ", "), strings.Join(still, ", ")),
+		discordStatusColor)
+}
+
+// describeDriftScope names a drift scope: a kind's fields, or a kind.search
+func describeDriftScope(scope string) string {
+	kind, search, ok := strings.Cut(scope, ".")
+	if !ok {
+		return kind + " fields"
+	}
+	return fmt.Sprintf("%s search %q", kind, search)
+}
+
+// details returns cached details for a listing, fetching and storing them
+// when missing or stale, the source supports it and canFetch is set. It
+// reports whether a request was made. Failures are logged and yield the
+// cached details (or nil) so the listing is still notified without enrichment.
+func (p *Poller) details(ctx context.Context, source ListingSource, listingID string, canFetch bool) (*ListingDetails, bool) {
+	detailSource, ok := source.(DetailSource)
+	if !ok {
+		return nil, false
+	}
+
+	cached, err := p.storage.GetDetails(ctx, listingID)
+	if err != nil {
+		log.Printf("Error reading cached details for %s: %v", listingID, err)
+	}
+	if cached != nil && cached.Fresh() {
+		return cached, false
+	}
+
+	if !canFetch {
+		return cached, false
+	}
+	if allowed, _ := p.breakers[source.Name()].Allow(); !allowed {
+		return cached, false
+	}
+
+	details, err := detailSource.FetchDetails(ctx, listingID)
+	if err != nil {
+		log.Printf("Error fetching details for %s: %v", listingID, err)
+		if CategoryOf(err) == ErrorCategoryBlocked {
+			p.recordBlocked(ctx, source.Name(), err)
+		}
+		return cached, true
+	}
+
+	if err := p.storage.SaveDetails(ctx, details); err != nil {
+		log.Printf("Error saving details for %s: %v", listingID, err)
+	}
+	return details, true
+}
+
+// Reconfigure swaps in new options; polls already running keep the old ones
+func (p *Poller) Reconfigure(opts PollerOptions) {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+
+	p.opts = opts
+}
+
+// options returns the current options
+func (p *Poller) options() PollerOptions {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+
+	return p.opts
+}
+
+// begin registers a poll as in flight, refusing once shutdown has started
+func (p *Poller) begin() bool {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+
+	if p.closed {
+		return false
+	}
+	p.inFlight.Add(1)
+	return true
+}
+
+// isClosed reports whether shutdown has started
+func (p *Poller) isClosed() bool {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+
+	return p.closed
+}
+
+// Shutdown stops new polls from starting and waits for the running poll.
+// If it is still running after the grace period, cancel is called so it
+// stops at the next safe point. It reports whether the poll finished in time.
+func (p *Poller) Shutdown(grace time.Duration, cancel context.CancelFunc) bool {
+	p.stateMu.Lock()
+	p.closed = true
+	p.stateMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(grace):
+		cancel()
+		<-done
+		return false
+	}
+}
+
+// pace waits discordMessageInterval after a Discord message. It returns
+// early on cancellation, which the poll loop checks before each listing.
+func pace(ctx context.Context) {
+	sleepContext(ctx, discordMessageInterval)
+}
+
+// sleepContext sleeps for d or until ctx is cancelled
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
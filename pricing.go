@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// defaultPriceDropMin is the smallest price cut notified when PRICE_DROP_MIN is unset
+const defaultPriceDropMin = "1%"
+
+// PriceDropThreshold is the smallest price cut worth a notification, either
+// as a percentage of the old price or as a dollar amount
+type PriceDropThreshold struct {
+	Disabled bool
+	Percent  float64
+	Amount   int
+}
+
+// parsePriceDropThreshold parses a PRICE_DROP_MIN value: "5%", "200" (dollars)
+// or "off"
+func parsePriceDropThreshold(value string) (PriceDropThreshold, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		value = defaultPriceDropMin
+	}
+	if strings.EqualFold(value, "off") {
+		return PriceDropThreshold{Disabled: true}, nil
+	}
+
+	if percent, ok := strings.CutSuffix(value, "%"); ok {
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(percent), 64)
+		if err != nil || parsed <= 0 || parsed >= 100 {
+			return PriceDropThreshold{}, fmt.Errorf("percentage must be between 0 and 100, got %q", value)
+		}
+		return PriceDropThreshold{Percent: parsed}, nil
+	}
+
+	amount, err := strconv.Atoi(strings.TrimPrefix(value, "$"))
+	if err != nil || amount <= 0 {
+		return PriceDropThreshold{}, fmt.Errorf(`must be a percentage like "5%%", a dollar amount like "200", or "off", got %q`, value)
+	}
+	return PriceDropThreshold{Amount: amount}, nil
+}
+
+// Notable reports whether a change from previous to current is a price cut
+// at least as big as the threshold
+func (t PriceDropThreshold) Notable(previous, current int) bool {
+	if t.Disabled || previous <= 0 || current <= 0 || current >= previous {
+		return false
+	}
+
+	drop := previous - current
+	if t.Percent > 0 {
+		return float64(drop) >= float64(previous)*t.Percent/100
+	}
+	return drop >= t.Amount
+}
+
+// priceChangePercent is the change from previous to current as a whole percentage
+func priceChangePercent(previous, current int) int {
+	if previous <= 0 {
+		return 0
+	}
+	change := float64(current-previous) / float64(previous) * 100
+	if change < 0 {
+		return -int(-change + 0.5)
+	}
+	return int(change + 0.5)
+}
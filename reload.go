@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// buildScheduler creates a cron scheduler with one entry per search, polling
+// under ctx. It is not started, so a failed build leaves any running
+// scheduler untouched.
+func buildScheduler(ctx context.Context, cfg *Config, poller *Poller) (*cron.Cron, error) {
+	c := cron.New()
+	for _, search := range cfg.Searches {
+		schedule := cfg.ScheduleFor(search)
+		cronSchedule, err := schedule.CronSchedule()
+		if err != nil {
+			return nil, fmt.Errorf("failed to build schedule for search %q: %w", search.Name, err)
+		}
+		c.Schedule(cronSchedule, cron.FuncJob(func() {
+			poller.Poll(ctx, []Search{search})
+		}))
+		log.Printf("Scheduled search %q: %s", search.Name, schedule.Describe())
+	}
+	return c, nil
+}
+
+// watchConfigFile signals on changed whenever the file's modification time
+// changes. It polls rather than relying on inotify so it also works on
+// bind-mounted config files.
+func watchConfigFile(path string, interval time.Duration, changed chan<- struct{}) {
+	lastMod := modTime(path)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		mod := modTime(path)
+		if mod.IsZero() || mod.Equal(lastMod) {
+			continue
+		}
+		lastMod = mod
+		select {
+		case changed <- struct{}{}:
+		default: // A reload is already pending
+		}
+	}
+}
+
+// modTime returns the file's modification time, or zero if it can't be read
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
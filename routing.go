@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Route sends listings matching its rules to a specific webhook.
+// Empty rules match everything, so a route with only Searches set
+// acts like a per-search webhook.
+type Route struct {
+	Name      string   `json:"name"`
+	Webhook   string   `json:"webhook"`
+	Searches  []string `json:"searches,omitempty"`
+	AreaNames []string `json:"areaNames,omitempty"`
+	MinPrice  int      `json:"minPrice,omitempty"`
+	MaxPrice  int      `json:"maxPrice,omitempty"`
+	MinBeds   *int     `json:"minBeds,omitempty"`
+	MaxBeds   *int     `json:"maxBeds,omitempty"`
+}
+
+// Validate checks that a route is well formed
+func (r *Route) Validate() error {
+	if r.Name == "" {
+		return errors.New("route name is required")
+	}
+	if r.Webhook == "" {
+		return fmt.Errorf("route %q: webhook is required", r.Name)
+	}
+	if r.MaxPrice > 0 && r.MinPrice > r.MaxPrice {
+		return fmt.Errorf("route %q: minPrice %d is greater than maxPrice %d", r.Name, r.MinPrice, r.MaxPrice)
+	}
+	if r.MinBeds != nil && r.MaxBeds != nil && *r.MinBeds > *r.MaxBeds {
+		return fmt.Errorf("route %q: minBeds %d is greater than maxBeds %d", r.Name, *r.MinBeds, *r.MaxBeds)
+	}
+	return nil
+}
+
+// Matches reports whether a listing satisfies every rule of the route
+func (r *Route) Matches(listing Listing) bool {
+	if len(r.Searches) > 0 && !containsString(r.Searches, listing.SearchName) {
+		return false
+	}
+	if len(r.AreaNames) > 0 && !containsFold(r.AreaNames, listing.AreaName) {
+		return false
+	}
+	if r.MinPrice > 0 && listing.Price < r.MinPrice {
+		return false
+	}
+	if r.MaxPrice > 0 && listing.Price > r.MaxPrice {
+		return false
+	}
+	if r.MinBeds != nil && listing.BedroomCount < *r.MinBeds {
+		return false
+	}
+	if r.MaxBeds != nil && listing.BedroomCount > *r.MaxBeds {
+		return false
+	}
+	return true
+}
+
+// WebhookRouter picks the destination webhook for a listing
+type WebhookRouter struct {
+	defaultURL     string
+	searchWebhooks map[string]string
+	routes         []Route
+}
+
+// NewWebhookRouter creates a router. A search's own webhook wins, then the
+// first matching route, then the default webhook.
+func NewWebhookRouter(defaultURL string, searches []Search, routes []Route) *WebhookRouter {
+	searchWebhooks := make(map[string]string)
+	for _, search := range searches {
+		if search.Webhook != "" {
+			searchWebhooks[search.Name] = search.Webhook
+		}
+	}
+
+	return &WebhookRouter{
+		defaultURL:     defaultURL,
+		searchWebhooks: searchWebhooks,
+		routes:         routes,
+	}
+}
+
+// WebhookFor returns the webhook URL a listing should be delivered to
+func (r *WebhookRouter) WebhookFor(listing Listing) string {
+	if url, ok := r.searchWebhooks[listing.SearchName]; ok {
+		return url
+	}
+	for i := range r.routes {
+		if r.routes[i].Matches(listing) {
+			return r.routes[i].Webhook
+		}
+	}
+	return r.defaultURL
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, target string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, target) {
+			return true
+		}
+	}
+	return false
+}
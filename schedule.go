@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	defaultCronSpec     = "*/30 * * * *"
+	defaultTimezone     = "America/New_York"
+	defaultDayStartHour = 8
+	defaultDayEndHour   = 20
+)
+
+// Duration is a time.Duration that reads from JSON strings like "10m"
+type Duration time.Duration
+
+// UnmarshalJSON parses a Go duration string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"10m\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON writes the duration as a Go duration string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Schedule controls when a search is polled. Either Cron or Adaptive may
+// be set; Jitter adds a random delay on top of either.
+type Schedule struct {
+	Cron     string            `json:"cron,omitempty"`
+	Jitter   Duration          `json:"jitter,omitempty"`
+	Adaptive *AdaptiveSchedule `json:"adaptive,omitempty"`
+}
+
+// AdaptiveSchedule polls at one interval during the day and another overnight
+type AdaptiveSchedule struct {
+	Timezone      string   `json:"timezone,omitempty"`
+	DayStartHour  *int     `json:"dayStartHour,omitempty"`
+	DayEndHour    *int     `json:"dayEndHour,omitempty"`
+	DayInterval   Duration `json:"dayInterval"`
+	NightInterval Duration `json:"nightInterval"`
+}
+
+// Validate checks that a schedule is well formed
+func (s *Schedule) Validate() error {
+	if s.Cron != "" && s.Adaptive != nil {
+		return errors.New("schedule cannot set both cron and adaptive")
+	}
+	if s.Jitter < 0 {
+		return errors.New("schedule jitter must not be negative")
+	}
+	if s.Cron != "" {
+		if _, err := cron.ParseStandard(s.Cron); err != nil {
+			return fmt.Errorf("invalid cron expression %q: %w", s.Cron, err)
+		}
+	}
+	if s.Adaptive != nil {
+		return s.Adaptive.validate()
+	}
+	return nil
+}
+
+func (a *AdaptiveSchedule) validate() error {
+	if a.DayInterval <= 0 || a.NightInterval <= 0 {
+		return errors.New("adaptive schedule requires positive dayInterval and nightInterval")
+	}
+	if _, err := time.LoadLocation(a.timezone()); err != nil {
+		return fmt.Errorf("invalid timezone %q: %w", a.timezone(), err)
+	}
+	start, end := a.dayHours()
+	if start < 0 || start > 23 || end < 0 || end > 24 || start >= end {
+		return fmt.Errorf("invalid day hours %d-%d", start, end)
+	}
+	return nil
+}
+
+func (a *AdaptiveSchedule) timezone() string {
+	if a.Timezone == "" {
+		return defaultTimezone
+	}
+	return a.Timezone
+}
+
+func (a *AdaptiveSchedule) dayHours() (int, int) {
+	start, end := defaultDayStartHour, defaultDayEndHour
+	if a.DayStartHour != nil {
+		start = *a.DayStartHour
+	}
+	if a.DayEndHour != nil {
+		end = *a.DayEndHour
+	}
+	return start, end
+}
+
+// CronSchedule builds the cron.Schedule for this configuration
+func (s *Schedule) CronSchedule() (cron.Schedule, error) {
+	var base cron.Schedule
+	if s.Adaptive != nil {
+		loc, err := time.LoadLocation(s.Adaptive.timezone())
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", s.Adaptive.timezone(), err)
+		}
+		start, end := s.Adaptive.dayHours()
+		base = &adaptiveSchedule{
+			loc:           loc,
+			dayStart:      start,
+			dayEnd:        end,
+			dayInterval:   time.Duration(s.Adaptive.DayInterval),
+			nightInterval: time.Duration(s.Adaptive.NightInterval),
+		}
+	} else {
+		spec := s.Cron
+		if spec == "" {
+			spec = defaultCronSpec
+		}
+		parsed, err := cron.ParseStandard(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", spec, err)
+		}
+		base = parsed
+	}
+
+	if s.Jitter > 0 {
+		return &jitterSchedule{base: base, jitter: time.Duration(s.Jitter)}, nil
+	}
+	return base, nil
+}
+
+// Describe returns a short human readable summary of the schedule
+func (s *Schedule) Describe() string {
+	var desc string
+	if s.Adaptive != nil {
+		start, end := s.Adaptive.dayHours()
+		desc = fmt.Sprintf("every %s from %02d:00-%02d:00, every %s otherwise (%s)",
+			time.Duration(s.Adaptive.DayInterval), start, end,
+			time.Duration(s.Adaptive.NightInterval), s.Adaptive.timezone())
+	} else if s.Cron != "" {
+		desc = fmt.Sprintf("cron %q", s.Cron)
+	} else {
+		desc = fmt.Sprintf("cron %q", defaultCronSpec)
+	}
+	if s.Jitter > 0 {
+		desc += fmt.Sprintf(" with up to %s jitter", time.Duration(s.Jitter))
+	}
+	return desc
+}
+
+// adaptiveSchedule picks the interval based on the local hour of day
+type adaptiveSchedule struct {
+	loc           *time.Location
+	dayStart      int
+	dayEnd        int
+	dayInterval   time.Duration
+	nightInterval time.Duration
+}
+
+// Next returns the next poll time after t
+func (a *adaptiveSchedule) Next(t time.Time) time.Time {
+	local := t.In(a.loc)
+	hour := local.Hour()
+
+	if hour >= a.dayStart && hour < a.dayEnd {
+		return t.Add(a.dayInterval).Truncate(time.Second)
+	}
+
+	// Overnight: don't sleep through the start of the day window
+	next := t.Add(a.nightInterval)
+	dayStart := time.Date(local.Year(), local.Month(), local.Day(), a.dayStart, 0, 0, 0, a.loc)
+	if !dayStart.After(local) {
+		dayStart = dayStart.AddDate(0, 0, 1)
+	}
+	if dayStart.Before(next) {
+		next = dayStart
+	}
+	return next.Truncate(time.Second)
+}
+
+// jitterSchedule delays each activation of its base schedule by a random amount
+type jitterSchedule struct {
+	base   cron.Schedule
+	jitter time.Duration
+}
+
+// Next returns the base schedule's next time plus a random jitter
+func (j *jitterSchedule) Next(t time.Time) time.Time {
+	next := j.base.Next(t)
+	if next.IsZero() {
+		return next
+	}
+	return next.Add(time.Duration(rand.Int63n(int64(j.jitter))))
+}
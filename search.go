@@ -0,0 +1,254 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// maxBedrooms is the largest bedroom bound accepted in a search
+const maxBedrooms = 10
+
+// Search is a named set of listing filters that is polled on its own
+type Search struct {
+	Name              string       `json:"name"`
+	Sources           []string     `json:"sources,omitempty"`
+	Kind              ListingKind  `json:"kind,omitempty"`
+	Areas             []int        `json:"areas,omitempty"`
+	AreaNames         []string     `json:"areaNames,omitempty"`
+	BuildingTypes     []string     `json:"buildingTypes,omitempty"`
+	MinPrice          int          `json:"minPrice,omitempty"`
+	MaxPrice          int          `json:"maxPrice,omitempty"`
+	MinBeds           *int         `json:"minBeds,omitempty"`
+	MaxBeds           *int         `json:"maxBeds,omitempty"`
+	MinFloor          *int         `json:"minFloor,omitempty"`
+	MaxFloor          *int         `json:"maxFloor,omitempty"`
+	Amenities         []string     `json:"amenities,omitempty"`
+	OptionalAmenities []string     `json:"optionalAmenities,omitempty"`
+	BoundingBox       *BoundingBox `json:"boundingBox,omitempty"`
+	Geofences         []Geofence   `json:"geofences,omitempty"`
+	GeofenceFiles     []string     `json:"geofenceFiles,omitempty"`
+	Webhook           string       `json:"webhook,omitempty"`
+	Schedule          *Schedule    `json:"schedule,omitempty"`
+}
+
+// BoundingBox is a rectangular geographic limit for a search
+type BoundingBox struct {
+	TopLeft     GeoPoint `json:"topLeft"`
+	BottomRight GeoPoint `json:"bottomRight"`
+}
+
+// GeoPoint is a latitude/longitude pair
+type GeoPoint struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// DefaultSearches returns the search used when no config file is provided
+func DefaultSearches() []Search {
+	beds := 3
+	return []Search{
+		{
+			Name:              "default",
+			Areas:             []int{104, 105, 106, 113, 115, 116, 117, 157, 158, 162},
+			BuildingTypes:     []string{"RENTAL"},
+			MinPrice:          1750,
+			MaxPrice:          9000,
+			MinBeds:           &beds,
+			MaxBeds:           &beds,
+			Amenities:         []string{"LAUNDRY", "PRIVATE_OUTDOOR_SPACE"},
+			OptionalAmenities: []string{"WASHER_DRYER"},
+			BoundingBox: &BoundingBox{
+				TopLeft:     GeoPoint{Latitude: 40.774, Longitude: -74.036},
+				BottomRight: GeoPoint{Latitude: 40.698, Longitude: -73.926},
+			},
+		},
+	}
+}
+
+// Validate checks that a search is well formed, reporting every problem
+func (s *Search) Validate() error {
+	if s.Name == "" {
+		return errors.New("search name is required")
+	}
+
+	var problems []error
+	if s.Kind != "" && s.Kind != ListingKindRental && s.Kind != ListingKindSale {
+		problems = append(problems, fmt.Errorf("kind must be %q or %q, got %q", ListingKindRental, ListingKindSale, s.Kind))
+	}
+	if len(s.Areas) == 0 {
+		problems = append(problems, errors.New("at least one area or areaName is required"))
+	}
+	if s.MinPrice < 0 || s.MaxPrice < 0 {
+		problems = append(problems, errors.New("price bounds must not be negative"))
+	}
+	if s.MaxPrice > 0 && s.MinPrice > s.MaxPrice {
+		problems = append(problems, fmt.Errorf("minPrice %d is greater than maxPrice %d", s.MinPrice, s.MaxPrice))
+	}
+	if (s.MinBeds != nil && (*s.MinBeds < 0 || *s.MinBeds > maxBedrooms)) ||
+		(s.MaxBeds != nil && (*s.MaxBeds < 0 || *s.MaxBeds > maxBedrooms)) {
+		problems = append(problems, fmt.Errorf("bedroom bounds must be between 0 and %d", maxBedrooms))
+	}
+	if s.MinBeds != nil && s.MaxBeds != nil && *s.MinBeds > *s.MaxBeds {
+		problems = append(problems, fmt.Errorf("minBeds %d is greater than maxBeds %d", *s.MinBeds, *s.MaxBeds))
+	}
+	if s.MinFloor != nil && s.MaxFloor != nil && *s.MinFloor > *s.MaxFloor {
+		problems = append(problems, fmt.Errorf("minFloor %d is greater than maxFloor %d", *s.MinFloor, *s.MaxFloor))
+	}
+	if s.BoundingBox != nil {
+		if err := s.BoundingBox.validate(); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if s.Schedule != nil {
+		if err := s.Schedule.Validate(); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	for i, name := range s.Sources {
+		canonical, ok := canonicalSourceName(name)
+		if !ok {
+			problems = append(problems, fmt.Errorf("unknown source %q (available: %s)", name, strings.Join(knownSources, ", ")))
+			continue
+		}
+		s.Sources[i] = canonical
+		if canonical == SourceCraigslist && s.IsSale() {
+			problems = append(problems, errors.New("the Craigslist source only supports rental searches"))
+		}
+	}
+
+	for i, err := range problems {
+		problems[i] = fmt.Errorf("search %q: %w", s.Name, err)
+	}
+	return errors.Join(problems...)
+}
+
+// validate checks coordinates are in range and the corners are the right way round
+func (b *BoundingBox) validate() error {
+	for _, p := range []GeoPoint{b.TopLeft, b.BottomRight} {
+		if p.Latitude < -90 || p.Latitude > 90 || p.Longitude < -180 || p.Longitude > 180 {
+			return fmt.Errorf("bounding box coordinate (%g, %g) is out of range", p.Latitude, p.Longitude)
+		}
+	}
+	if b.TopLeft.Latitude <= b.BottomRight.Latitude || b.TopLeft.Longitude >= b.BottomRight.Longitude {
+		return errors.New("bounding box topLeft must be north-west of bottomRight")
+	}
+	return nil
+}
+
+// IsSale reports whether the search is for sales rather than rentals
+func (s *Search) IsSale() bool {
+	return s.Kind == ListingKindSale
+}
+
+// Filters translates the search into the SearchRentalsInput or
+// SearchSalesInput filters object
+func (s *Search) Filters() map[string]interface{} {
+	filters := map[string]interface{}{
+		"areas": s.Areas,
+	}
+	if s.IsSale() {
+		filters["saleStatus"] = "ACTIVE"
+	} else {
+		filters["rentalStatus"] = "ACTIVE"
+	}
+
+	if len(s.BuildingTypes) > 0 {
+		filters["buildingType"] = s.BuildingTypes
+	}
+
+	if s.MinPrice > 0 || s.MaxPrice > 0 {
+		price := map[string]interface{}{}
+		if s.MinPrice > 0 {
+			price["lowerBound"] = s.MinPrice
+		}
+		if s.MaxPrice > 0 {
+			price["upperBound"] = s.MaxPrice
+		}
+		filters["price"] = price
+	}
+
+	if s.MinBeds != nil || s.MaxBeds != nil {
+		bedrooms := map[string]interface{}{}
+		if s.MinBeds != nil {
+			bedrooms["lowerBound"] = *s.MinBeds
+		}
+		if s.MaxBeds != nil {
+			bedrooms["upperBound"] = *s.MaxBeds
+		}
+		filters["bedrooms"] = bedrooms
+	}
+
+	if len(s.Amenities) > 0 {
+		filters["amenities"] = s.Amenities
+	}
+	if len(s.OptionalAmenities) > 0 {
+		filters["optionalAmenities"] = s.OptionalAmenities
+	}
+
+	if s.BoundingBox != nil {
+		filters["boundingBox"] = map[string]interface{}{
+			"topLeft": map[string]interface{}{
+				"latitude":  s.BoundingBox.TopLeft.Latitude,
+				"longitude": s.BoundingBox.TopLeft.Longitude,
+			},
+			"bottomRight": map[string]interface{}{
+				"latitude":  s.BoundingBox.BottomRight.Latitude,
+				"longitude": s.BoundingBox.BottomRight.Longitude,
+			},
+		}
+	}
+
+	return filters
+}
+
+// OnFloor reports whether a listing's unit is within the search's floor
+// bounds. Floors come from parsing the unit (basements are -1); listings
+// whose floor is unknown are accepted, and penthouses count as above any floor.
+func (s *Search) OnFloor(listing Listing) bool {
+	if s.MinFloor == nil && s.MaxFloor == nil {
+		return true
+	}
+
+	unit := listing.UnitInfo
+	if unit.Penthouse {
+		return s.MaxFloor == nil
+	}
+	if unit.Floor == 0 {
+		return true
+	}
+	if s.MinFloor != nil && unit.Floor < *s.MinFloor {
+		return false
+	}
+	if s.MaxFloor != nil && unit.Floor > *s.MaxFloor {
+		return false
+	}
+	return true
+}
+
+// InGeofence reports whether a listing falls inside the search's geofences.
+// Searches without geofences accept everything; listings without
+// coordinates can't be placed and are rejected when geofences are set.
+func (s *Search) InGeofence(listing Listing) bool {
+	if len(s.Geofences) == 0 {
+		return true
+	}
+	if !listing.HasCoordinates() {
+		return false
+	}
+	for i := range s.Geofences {
+		if s.Geofences[i].Contains(listing.Latitude, listing.Longitude) {
+			return true
+		}
+	}
+	return false
+}
+
+// searchNames returns the names of the searches, in order
+func searchNames(searches []Search) []string {
+	names := make([]string, 0, len(searches))
+	for _, search := range searches {
+		names = append(names, search.Name)
+	}
+	return names
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// maxShardDepth bounds how many times a search is split in half
+	maxShardDepth = 6
+
+	// Pivots used to split a price band with no upper bound
+	rentalShardPricePivot = 5000
+	saleShardPricePivot   = 1500000
+
+	// Bands narrower than this are split by area instead
+	rentalMinShardBand = 100
+	saleMinShardBand   = 25000
+)
+
+// splitSearch splits a search into two narrower shards, by price band when
+// the band is wide enough and by area subset otherwise. It returns nil when
+// the search can't be split further.
+func splitSearch(search Search) []Search {
+	if shards := splitByPrice(search); shards != nil {
+		return shards
+	}
+	return splitByArea(search)
+}
+
+// splitByPrice halves the search's price band. Bounds are inclusive, so the
+// shards are [lo, mid] and [mid+1, hi].
+func splitByPrice(search Search) []Search {
+	pivot, minBand := rentalShardPricePivot, rentalMinShardBand
+	if search.IsSale() {
+		pivot, minBand = saleShardPricePivot, saleMinShardBand
+	}
+
+	lo, hi := search.MinPrice, search.MaxPrice
+	var mid int
+	if hi > 0 {
+		if hi-lo < 2*minBand {
+			return nil
+		}
+		mid = lo + (hi-lo)/2
+	} else {
+		// Unbounded above: carve off everything up to a pivot above lo
+		mid = max(pivot, lo*2)
+	}
+
+	lower, upper := search, search
+	lower.MaxPrice = mid
+	upper.MinPrice = mid + 1
+	return []Search{lower, upper}
+}
+
+// splitByArea halves the search's area list
+func splitByArea(search Search) []Search {
+	if len(search.Areas) < 2 {
+		return nil
+	}
+
+	half := len(search.Areas) / 2
+	lower, upper := search, search
+	lower.Areas = append([]int(nil), search.Areas[:half]...)
+	upper.Areas = append([]int(nil), search.Areas[half:]...)
+	return []Search{lower, upper}
+}
+
+// describeShard summarizes the price band and areas of a (shard of a) search
+func describeShard(search Search) string {
+	price := fmt.Sprintf("$%d+", search.MinPrice)
+	if search.MaxPrice > 0 {
+		price = fmt.Sprintf("$%d-$%d", search.MinPrice, search.MaxPrice)
+	}
+
+	areas := make([]string, len(search.Areas))
+	for i, id := range search.Areas {
+		areas[i] = fmt.Sprintf("%d", id)
+	}
+	return fmt.Sprintf("price %s, areas %s", price, strings.Join(areas, ","))
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"strings"
+)
+
+// Listing source names
+const (
+	SourceStreetEasy = "StreetEasy"
+	SourceCraigslist = "Craigslist"
+)
+
+// knownSources are the source names a search may ask for
+var knownSources = []string{SourceStreetEasy, SourceCraigslist}
+
+// ListingSource fetches the listings matching a search from one site. The
+// listings it returns are normalized and tagged with the source name. IDs
+// must be unique across sources, so sources other than StreetEasy prefix
+// theirs with the source name.
+type ListingSource interface {
+	Name() string
+	FetchListings(ctx context.Context, search Search) (*FetchResult, error)
+}
+
+// FetchResult is what a source returned for a search, across every page
+// (and, for StreetEasy, every shard) it fetched
+type FetchResult struct {
+	Listings   []Listing
+	TotalCount int
+	Pages      int
+	Shards     int
+	Truncated  bool
+
+	// Partial is set by sources that only return a recent window of
+	// matching listings, so a listing missing from it may still be on the market
+	Partial bool
+}
+
+// DetailSource is a ListingSource that can enrich a new listing with data
+// from its detail page
+type DetailSource interface {
+	FetchDetails(ctx context.Context, listingID string) (*ListingDetails, error)
+}
+
+// StatusSource is a ListingSource that can look up the current API status
+// of a listing that dropped out of its search results
+type StatusSource interface {
+	FetchStatus(ctx context.Context, listingID string, kind ListingKind) (string, error)
+}
+
+// SchemaSource is a ListingSource that keeps raw API nodes on its listings
+// and knows which fields each node should carry, for schema drift checks
+type SchemaSource interface {
+	NodeFields() map[ListingKind][]string
+}
+
+// SourceNames returns the sources a search runs against, defaulting to StreetEasy
+func (s *Search) SourceNames() []string {
+	if len(s.Sources) == 0 {
+		return []string{SourceStreetEasy}
+	}
+	return s.Sources
+}
+
+// canonicalSourceName returns the known source name matching name, ignoring case
+func canonicalSourceName(name string) (string, bool) {
+	for _, known := range knownSources {
+		if strings.EqualFold(known, name) {
+			return known, true
+		}
+	}
+	return "", false
+}
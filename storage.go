@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -52,14 +56,179 @@ func (s *Storage) initSchema() error {
 		return fmt.Errorf("failed to create table: %w", err)
 	}
 
+	detailsQuery := `
+	CREATE TABLE IF NOT EXISTS listing_details (
+		listing_id TEXT PRIMARY KEY,
+		sqft INTEGER,
+		no_fee BOOLEAN,
+		available_at TEXT,
+		amenities TEXT,
+		description TEXT,
+		concessions TEXT,
+		fetched_at DATETIME NOT NULL
+	);
+	`
+
+	if _, err := s.db.Exec(detailsQuery); err != nil {
+		return fmt.Errorf("failed to create listing_details table: %w", err)
+	}
+	if err := s.ensureColumn("listing_details", "photos", "TEXT"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("listing_details", "floor_plans", "TEXT"); err != nil {
+		return err
+	}
+
+	// Columns added after the initial schema
+	columns := []struct{ name, definition string }{
+		{"kind", "TEXT NOT NULL DEFAULT 'rental'"},
+		{"latitude", "REAL"},
+		{"longitude", "REAL"},
+		{"tier", "TEXT"},
+		{"rello_link", "TEXT"},
+		{"rello_rental_id", "TEXT"},
+		{"search_criteria", "TEXT"},
+		{"source", "TEXT NOT NULL DEFAULT 'StreetEasy'"},
+		{"url_path", "TEXT"},
+		{"dedup_key", "TEXT"},
+		{"search_name", "TEXT"},
+		{"bedroom_count", "INTEGER"},
+		{"full_bathroom_count", "INTEGER"},
+		{"half_bathroom_count", "INTEGER"},
+		{"building_type", "TEXT"},
+		{"broker", "TEXT"},
+		{"photo_key", "TEXT"},
+		{"status", "TEXT"},
+		{"maintenance", "INTEGER"},
+		{"common_charges", "INTEGER"},
+		{"taxes", "INTEGER"},
+		{"rello_cta_enabled", "BOOLEAN"},
+		{"headline", "TEXT"},
+		{"normalized_street", "TEXT"},
+		{"unit_floor", "INTEGER"},
+		{"raw_json", "TEXT"},
+		{"last_seen_at", "DATETIME"},
+		{"lifecycle_state", "TEXT NOT NULL DEFAULT 'active'"},
+		{"missed_polls", "INTEGER NOT NULL DEFAULT 0"},
+		{"off_market_at", "DATETIME"},
+		{"back_on_market_at", "DATETIME"},
+		{"time_on_market_seconds", "INTEGER"},
+	}
+	for _, column := range columns {
+		if err := s.ensureColumn("seen_listings", column.name, column.definition); err != nil {
+			return err
+		}
+	}
+
+	historyQuery := `
+	CREATE TABLE IF NOT EXISTS price_history (
+		listing_id TEXT NOT NULL,
+		price INTEGER NOT NULL,
+		observed_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_price_history_listing ON price_history (listing_id, observed_at);
+	`
+
+	if _, err := s.db.Exec(historyQuery); err != nil {
+		return fmt.Errorf("failed to create price_history table: %w", err)
+	}
+
+	eventsQuery := `
+	CREATE TABLE IF NOT EXISTS listing_events (
+		listing_id TEXT NOT NULL,
+		event TEXT NOT NULL,
+		state TEXT NOT NULL,
+		observed_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		time_on_market_seconds INTEGER
+	);
+	CREATE INDEX IF NOT EXISTS idx_listing_events_listing ON listing_events (listing_id, observed_at);
+	CREATE INDEX IF NOT EXISTS idx_seen_listings_search ON seen_listings (source, search_name, lifecycle_state);
+	`
+
+	if _, err := s.db.Exec(eventsQuery); err != nil {
+		return fmt.Errorf("failed to create listing_events table: %w", err)
+	}
+
+	membershipQuery := `
+	CREATE TABLE IF NOT EXISTS listing_searches (
+		listing_id TEXT NOT NULL,
+		source TEXT NOT NULL,
+		search_name TEXT NOT NULL,
+		missed_polls INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (listing_id, search_name)
+	);
+	CREATE INDEX IF NOT EXISTS idx_listing_searches_search ON listing_searches (source, search_name);
+	`
+
+	if _, err := s.db.Exec(membershipQuery); err != nil {
+		return fmt.Errorf("failed to create listing_searches table: %w", err)
+	}
+
+	// Listings seen before membership was tracked belong to the search that saw them last
+	_, err = s.db.Exec(`
+	INSERT OR IGNORE INTO listing_searches (listing_id, source, search_name, missed_polls)
+	SELECT id, source, search_name, missed_polls FROM seen_listings WHERE COALESCE(search_name, '') != ''
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to backfill listing_searches: %w", err)
+	}
+
+	// Rows from before last_seen_at existed were last known seen when first seen
+	if _, err := s.db.Exec(`UPDATE seen_listings SET last_seen_at = first_seen_at WHERE last_seen_at IS NULL`); err != nil {
+		return fmt.Errorf("failed to backfill last_seen_at: %w", err)
+	}
+
+	// Listings seen before dedup keys were stored have none until they are
+	// seen again; until then only listings without a street can match them,
+	// by location
+	if _, err := s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_seen_listings_dedup_key ON seen_listings (dedup_key)`); err != nil {
+		return fmt.Errorf("failed to create dedup key index: %w", err)
+	}
+
+	return nil
+}
+
+// ensureColumn adds a column to an existing table if it is missing
+func (s *Storage) ensureColumn(table, column, definition string) error {
+	rows, err := s.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to read %s schema: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			columnType string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return fmt.Errorf("failed to read %s schema: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read %s schema: %w", table, err)
+	}
+
+	_, err = s.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+
 	return nil
 }
 
 // IsNew checks if a listing ID has not been seen before
-func (s *Storage) IsNew(listingID string) (bool, error) {
+func (s *Storage) IsNew(ctx context.Context, listingID string) (bool, error) {
 	var exists int
 	query := `SELECT 1 FROM seen_listings WHERE id = ? LIMIT 1`
-	err := s.db.QueryRow(query, listingID).Scan(&exists)
+	err := s.db.QueryRowContext(ctx, query, listingID).Scan(&exists)
 
 	if err == sql.ErrNoRows {
 		return true, nil // Not found = new listing
@@ -71,16 +240,541 @@ func (s *Storage) IsNew(listingID string) (bool, error) {
 	return false, nil // Found = not new
 }
 
-// MarkSeen inserts a listing into the database
-func (s *Storage) MarkSeen(listing Listing) error {
+// MarkSeen stores a snapshot of every field of a listing, including its raw
+// API node. A listing seen before keeps its first_seen_at and has the rest
+// of its snapshot and last_seen_at brought up to date.
+func (s *Storage) MarkSeen(ctx context.Context, listing Listing) error {
 	query := `
-	INSERT OR IGNORE INTO seen_listings (id, street, unit, area_name, price)
-	VALUES (?, ?, ?, ?, ?)
+	INSERT INTO seen_listings (
+		id, kind, street, unit, area_name, price,
+		latitude, longitude, tier, rello_link, rello_rental_id, search_criteria, source,
+		url_path, dedup_key, search_name, bedroom_count, full_bathroom_count, half_bathroom_count,
+		building_type, broker, photo_key, status, maintenance, common_charges, taxes,
+		rello_cta_enabled, headline, normalized_street, unit_floor, raw_json, last_seen_at
+	)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT (id) DO UPDATE SET
+		kind = excluded.kind,
+		street = excluded.street,
+		unit = excluded.unit,
+		area_name = excluded.area_name,
+		price = excluded.price,
+		latitude = excluded.latitude,
+		longitude = excluded.longitude,
+		tier = excluded.tier,
+		rello_link = excluded.rello_link,
+		rello_rental_id = excluded.rello_rental_id,
+		search_criteria = excluded.search_criteria,
+		source = excluded.source,
+		url_path = excluded.url_path,
+		dedup_key = excluded.dedup_key,
+		search_name = excluded.search_name,
+		bedroom_count = excluded.bedroom_count,
+		full_bathroom_count = excluded.full_bathroom_count,
+		half_bathroom_count = excluded.half_bathroom_count,
+		building_type = excluded.building_type,
+		broker = excluded.broker,
+		photo_key = excluded.photo_key,
+		status = excluded.status,
+		maintenance = excluded.maintenance,
+		common_charges = excluded.common_charges,
+		taxes = excluded.taxes,
+		rello_cta_enabled = excluded.rello_cta_enabled,
+		headline = excluded.headline,
+		normalized_street = excluded.normalized_street,
+		unit_floor = excluded.unit_floor,
+		raw_json = COALESCE(excluded.raw_json, seen_listings.raw_json),
+		last_seen_at = excluded.last_seen_at
 	`
 
-	_, err := s.db.Exec(query, listing.ID, listing.Street, listing.Unit, listing.AreaName, listing.Price)
+	kind := listing.Kind
+	if kind == "" {
+		kind = ListingKindRental
+	}
+
+	source := listing.Source
+	if source == "" {
+		source = SourceStreetEasy
+	}
+
+	var dedupKey sql.NullString
+	if key := dedupKeyFor(listing); key != "" {
+		dedupKey = sql.NullString{String: key, Valid: true}
+	}
+
+	var latitude, longitude sql.NullFloat64
+	if listing.HasCoordinates() {
+		latitude = sql.NullFloat64{Float64: listing.Latitude, Valid: true}
+		longitude = sql.NullFloat64{Float64: listing.Longitude, Valid: true}
+	}
+
+	var floor sql.NullInt64
+	if listing.UnitInfo.Floor != 0 {
+		floor = sql.NullInt64{Int64: int64(listing.UnitInfo.Floor), Valid: true}
+	}
+
+	var raw sql.NullString
+	if len(listing.Raw) > 0 {
+		raw = sql.NullString{String: string(listing.Raw), Valid: true}
+	}
+
+	_, err := s.db.ExecContext(ctx, query,
+		listing.ID, string(kind), listing.Street, listing.Unit, listing.AreaName, listing.Price,
+		latitude, longitude, listing.Tier, listing.RelloLink, listing.RelloRentalID, listing.SearchCriteria, source,
+		listing.URLPath, dedupKey, listing.SearchName, listing.BedroomCount, listing.FullBathroomCount, listing.HalfBathroomCount,
+		listing.BuildingType, listing.SourceGroupLabel, listing.PhotoKey, listing.Status, listing.Maintenance, listing.CommonCharges, listing.Taxes,
+		listing.RelloCTAEnabled, listing.Headline, listing.NormalizedStreet, floor, raw,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save listing: %w", err)
+	}
+
+	if listing.SearchName != "" {
+		if err := upsertMembership(ctx, s.db, listing.ID, source, listing.SearchName); err != nil {
+			return fmt.Errorf("failed to save listing search: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// execer is a database or transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// upsertMembership records that a search returned a seen listing, resetting
+// its missed-poll count for that search
+func upsertMembership(ctx context.Context, db execer, listingID, source, searchName string) error {
+	_, err := db.ExecContext(ctx, `
+	INSERT INTO listing_searches (listing_id, source, search_name)
+	SELECT id, ?, ? FROM seen_listings WHERE id = ?
+	ON CONFLICT (listing_id, search_name) DO UPDATE SET missed_polls = 0
+	`, source, searchName, listingID)
+	return err
+}
+
+// RecordPrice adds a listing's observed price to its history, one row per
+// observation, and returns the price observed before it (0 if none).
+// Listings seen before price history existed fall back to their stored
+// snapshot price, so for an already-seen listing call this before MarkSeen
+// overwrites it. A new listing has no snapshot to fall back to, so it is
+// recorded after MarkSeen, once it is known to be stored.
+func (s *Storage) RecordPrice(ctx context.Context, listingID string, price int) (previous int, err error) {
+	query := `SELECT price FROM price_history WHERE listing_id = ? ORDER BY observed_at DESC, rowid DESC LIMIT 1`
+	err = s.db.QueryRowContext(ctx, query, listingID).Scan(&previous)
+	if err == sql.ErrNoRows {
+		query = `SELECT COALESCE(price, 0) FROM seen_listings WHERE id = ?`
+		err = s.db.QueryRowContext(ctx, query, listingID).Scan(&previous)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("failed to read price history: %w", err)
+	}
+
+	if price <= 0 {
+		return previous, nil
+	}
+
+	_, err = s.db.ExecContext(ctx, `INSERT INTO price_history (listing_id, price) VALUES (?, ?)`, listingID, price)
+	if err != nil {
+		return previous, fmt.Errorf("failed to record price: %w", err)
+	}
+
+	return previous, nil
+}
+
+// UpdateLifecycle records that a seen listing was present in a poll. It
+// resets its missed-poll count and brings it back to active if it had left
+// the market. It returns the change, or nil if the state didn't change.
+func (s *Storage) UpdateLifecycle(ctx context.Context, listing Listing) (*LifecycleChange, error) {
+	var state string
+	var offMarketAt sql.NullTime
+	query := `SELECT lifecycle_state, off_market_at FROM seen_listings WHERE id = ?`
+	err := s.db.QueryRowContext(ctx, query, listing.ID).Scan(&state, &offMarketAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lifecycle: %w", err)
+	}
+
+	if state == LifecycleActive {
+		if _, err := s.db.ExecContext(ctx, `UPDATE seen_listings SET missed_polls = 0 WHERE id = ?`, listing.ID); err != nil {
+			return nil, fmt.Errorf("failed to update lifecycle: %w", err)
+		}
+		return nil, nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update lifecycle: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Back on the market; its time on market keeps counting from now
+	_, err = tx.ExecContext(ctx, `
+	UPDATE seen_listings
+	SET lifecycle_state = ?, missed_polls = 0, back_on_market_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`, LifecycleActive, listing.ID)
+	if err == nil {
+		err = insertEvent(ctx, tx, listing.ID, EventBackOnMarket, LifecycleActive, sql.NullInt64{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update lifecycle: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to update lifecycle: %w", err)
+	}
+	return &LifecycleChange{
+		ListingID:   listing.ID,
+		Kind:        duplicateKind(listing),
+		From:        state,
+		To:          LifecycleActive,
+		OffMarketAt: offMarketAt.Time,
+	}, nil
+}
+
+// MarkClosed moves a listing into the rented or sold state once its looked
+// up status says it was taken. A listing still active leaves the market; one
+// already off it just records why. It returns the change, or nil if the
+// state didn't change.
+func (s *Storage) MarkClosed(ctx context.Context, listingID, state string) (*LifecycleChange, error) {
+	var current string
+	query := `SELECT lifecycle_state FROM seen_listings WHERE id = ?`
+	err := s.db.QueryRowContext(ctx, query, listingID).Scan(&current)
+	if err == sql.ErrNoRows || (err == nil && current == state) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lifecycle: %w", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark listing closed: %w", err)
+	}
+	defer tx.Rollback()
+
+	change := &LifecycleChange{ListingID: listingID, From: current, To: state}
+	if current == LifecycleActive {
+		change.TimeOnMarket, err = leaveMarket(ctx, tx, listingID, state, EventClosed)
+	} else {
+		_, err = tx.ExecContext(ctx, `UPDATE seen_listings SET lifecycle_state = ? WHERE id = ?`, state, listingID)
+		if err == nil {
+			err = insertEvent(ctx, tx, listingID, EventClosed, state, sql.NullInt64{})
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark listing closed: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to mark listing closed: %w", err)
+	}
+	return change, nil
+}
+
+// RecordAbsences counts a missed poll in this search for every active
+// listing the search has returned before that isn't in present. A listing
+// is marked disappeared once every search that returned it has missed it
+// for threshold consecutive polls, so one search dropping a listing that
+// another still returns doesn't take it off the market. Only call it for
+// fetches that returned complete results. It returns the listings that left
+// the market.
+func (s *Storage) RecordAbsences(ctx context.Context, source, searchName string, present map[string]bool, threshold int) ([]LifecycleChange, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record absences: %w", err)
+	}
+	defer tx.Rollback()
+
+	for id := range present {
+		if err := upsertMembership(ctx, tx, id, source, searchName); err != nil {
+			return nil, fmt.Errorf("failed to record absences: %w", err)
+		}
+	}
+
+	query := `
+	SELECT m.listing_id, l.kind, m.missed_polls
+	FROM listing_searches m JOIN seen_listings l ON l.id = m.listing_id
+	WHERE m.source = ? AND m.search_name = ? AND l.lifecycle_state = ?
+	`
+	rows, err := tx.QueryContext(ctx, query, source, searchName, LifecycleActive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record absences: %w", err)
+	}
+
+	missed := make(map[string]int)
+	kinds := make(map[string]ListingKind)
+	for rows.Next() {
+		var id string
+		var kind ListingKind
+		var count int
+		if err := rows.Scan(&id, &kind, &count); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to record absences: %w", err)
+		}
+		if !present[id] {
+			missed[id] = count + 1
+			kinds[id] = kind
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to record absences: %w", err)
+	}
+
+	var changes []LifecycleChange
+	for id, count := range missed {
+		if _, err := tx.ExecContext(ctx, `UPDATE listing_searches SET missed_polls = ? WHERE listing_id = ? AND search_name = ?`, count, id, searchName); err != nil {
+			return nil, fmt.Errorf("failed to record absences: %w", err)
+		}
+
+		// The listing's own count is how many polls every search has missed it for
+		var everyMissed int
+		query := `SELECT MIN(missed_polls) FROM listing_searches WHERE listing_id = ?`
+		if err := tx.QueryRowContext(ctx, query, id).Scan(&everyMissed); err != nil {
+			return nil, fmt.Errorf("failed to record absences: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE seen_listings SET missed_polls = ? WHERE id = ?`, everyMissed, id); err != nil {
+			return nil, fmt.Errorf("failed to record absences: %w", err)
+		}
+		if everyMissed < threshold {
+			continue
+		}
+
+		timeOnMarket, err := leaveMarket(ctx, tx, id, LifecycleDisappeared, EventOffMarket)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record absences: %w", err)
+		}
+		changes = append(changes, LifecycleChange{
+			ListingID:    id,
+			Kind:         kinds[id],
+			From:         LifecycleActive,
+			To:           LifecycleDisappeared,
+			TimeOnMarket: timeOnMarket,
+		})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to record absences: %w", err)
+	}
+	return changes, nil
+}
+
+// ForgetSearches drops the search memberships of searches no longer
+// configured, so a removed or renamed search can't keep its listings on the
+// market forever
+func (s *Storage) ForgetSearches(ctx context.Context, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ")
+	args := make([]interface{}, len(names))
+	for i, name := range names {
+		args[i] = name
+	}
+	query := fmt.Sprintf(`DELETE FROM listing_searches WHERE search_name NOT IN (%s)`, placeholders)
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to forget searches: %w", err)
+	}
+	return nil
+}
+
+// leaveMarket moves an active listing off the market, adding the time since
+// it was first seen (or last came back) up to when it was last seen to its
+// time on market, and records the event
+func leaveMarket(ctx context.Context, tx *sql.Tx, listingID, state, event string) (time.Duration, error) {
+	_, err := tx.ExecContext(ctx, `
+	UPDATE seen_listings
+	SET lifecycle_state = ?,
+		off_market_at = CURRENT_TIMESTAMP,
+		time_on_market_seconds = COALESCE(time_on_market_seconds, 0) + CAST(
+			(julianday(last_seen_at) - julianday(COALESCE(back_on_market_at, first_seen_at))) * 86400 AS INTEGER)
+	WHERE id = ?
+	`, state, listingID)
+	if err != nil {
+		return 0, err
+	}
+
+	var seconds sql.NullInt64
+	query := `SELECT time_on_market_seconds FROM seen_listings WHERE id = ?`
+	if err := tx.QueryRowContext(ctx, query, listingID).Scan(&seconds); err != nil {
+		return 0, err
+	}
+
+	if err := insertEvent(ctx, tx, listingID, event, state, seconds); err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds.Int64) * time.Second, nil
+}
+
+// insertEvent records a lifecycle event
+func insertEvent(ctx context.Context, tx *sql.Tx, listingID, event, state string, timeOnMarket sql.NullInt64) error {
+	query := `INSERT INTO listing_events (listing_id, event, state, time_on_market_seconds) VALUES (?, ?, ?, ?)`
+	_, err := tx.ExecContext(ctx, query, listingID, event, state, timeOnMarket)
+	return err
+}
+
+// SeenListing is a previously notified listing
+type SeenListing struct {
+	ID          string
+	Source      string
+	Street      string
+	Unit        string
+	Price       int
+	URLPath     string
+	FirstSeenAt time.Time
+}
+
+// URL returns the listing page
+func (s *SeenListing) URL() string {
+	return listingURL(s.URLPath)
+}
+
+// FindDuplicate returns the earliest seen listing for the same apartment as
+// listing under a different ID, at a similar price, or nil if there is none.
+// Listings match on their dedup key, or on location and bedrooms when one of
+// them has no street.
+func (s *Storage) FindDuplicate(ctx context.Context, listing Listing) (*SeenListing, error) {
+	key := dedupKeyFor(listing)
+	if key != "" {
+		query := duplicateColumns + `WHERE dedup_key = ? AND id != ? ORDER BY first_seen_at`
+		original, err := s.findSimilarPrice(ctx, listing, query, key, listing.ID)
+		if original != nil || err != nil {
+			return original, err
+		}
+	}
+
+	// Listings without a street, like most Craigslist posts, can only be
+	// matched by where they are, so this only pairs them with each other or
+	// with listings that have one. Rows stored before dedup keys existed have
+	// no key but do have a street, so the street itself is checked.
+	if !listing.HasCoordinates() {
+		return nil, nil
+	}
+	query := duplicateColumns + `
+	WHERE id != ? AND kind = ? AND COALESCE(bedroom_count, 0) = ?
+		AND latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?
+		AND (? = '' OR TRIM(COALESCE(street, '')) = '')
+	ORDER BY first_seen_at
+	`
+	return s.findSimilarPrice(ctx, listing, query,
+		listing.ID, duplicateKind(listing), listing.BedroomCount,
+		listing.Latitude-duplicateCoordinateTolerance, listing.Latitude+duplicateCoordinateTolerance,
+		listing.Longitude-duplicateCoordinateTolerance, listing.Longitude+duplicateCoordinateTolerance,
+		key)
+}
+
+// duplicateColumns selects the seen listing fields FindDuplicate returns
+const duplicateColumns = `
+	SELECT id, source, COALESCE(street, ''), COALESCE(unit, ''), COALESCE(price, 0),
+		COALESCE(url_path, ''), first_seen_at
+	FROM seen_listings
+	`
+
+// findSimilarPrice returns the first candidate from query whose price is
+// close to the listing's
+func (s *Storage) findSimilarPrice(ctx context.Context, listing Listing, query string, args ...interface{}) (*SeenListing, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up duplicates: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var seen SeenListing
+		if err := rows.Scan(&seen.ID, &seen.Source, &seen.Street, &seen.Unit, &seen.Price, &seen.URLPath, &seen.FirstSeenAt); err != nil {
+			return nil, fmt.Errorf("failed to read duplicate: %w", err)
+		}
+		if similarPrice(seen.Price, listing.Price) {
+			return &seen, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to look up duplicates: %w", err)
+	}
+
+	return nil, nil
+}
+
+// GetDetails returns stored details for a listing, or nil if none are stored
+func (s *Storage) GetDetails(ctx context.Context, listingID string) (*ListingDetails, error) {
+	query := `
+	SELECT sqft, no_fee, available_at, amenities, description, concessions,
+		COALESCE(photos, ''), COALESCE(floor_plans, ''), fetched_at
+	FROM listing_details WHERE listing_id = ?
+	`
+
+	details := &ListingDetails{ListingID: listingID}
+	var amenities, photos, floorPlans string
+	err := s.db.QueryRowContext(ctx, query, listingID).Scan(
+		&details.SquareFeet, &details.NoFee, &details.AvailableAt, &amenities,
+		&details.Description, &details.Concessions, &photos, &floorPlans, &details.FetchedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get listing details: %w", err)
+	}
+
+	for _, column := range []struct {
+		name string
+		raw  string
+		dest *[]string
+	}{
+		{"amenities", amenities, &details.Amenities},
+		{"photos", photos, &details.PhotoKeys},
+		{"floor_plans", floorPlans, &details.FloorPlans},
+	} {
+		if column.raw == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(column.raw), column.dest); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", column.name, err)
+		}
+	}
+
+	return details, nil
+}
+
+// SaveDetails stores or replaces the details for a listing
+func (s *Storage) SaveDetails(ctx context.Context, details *ListingDetails) error {
+	query := `
+	INSERT OR REPLACE INTO listing_details
+		(listing_id, sqft, no_fee, available_at, amenities, description, concessions, photos, floor_plans, fetched_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	amenities, err := json.Marshal(details.Amenities)
+	if err != nil {
+		return fmt.Errorf("failed to encode amenities: %w", err)
+	}
+	photos, err := json.Marshal(details.PhotoKeys)
+	if err != nil {
+		return fmt.Errorf("failed to encode photos: %w", err)
+	}
+	floorPlans, err := json.Marshal(details.FloorPlans)
+	if err != nil {
+		return fmt.Errorf("failed to encode floor plans: %w", err)
+	}
+
+	fetchedAt := details.FetchedAt
+	if fetchedAt.IsZero() {
+		fetchedAt = time.Now()
+	}
+
+	_, err = s.db.ExecContext(ctx, query,
+		details.ListingID, details.SquareFeet, details.NoFee, details.AvailableAt,
+		string(amenities), details.Description, details.Concessions,
+		string(photos), string(floorPlans), fetchedAt.UTC(),
+	)
 	if err != nil {
-		return fmt.Errorf("failed to insert listing: %w", err)
+		return fmt.Errorf("failed to save listing details: %w", err)
 	}
 
 	return nil
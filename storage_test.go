@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func newTestStorage(t *testing.T) *Storage {
+	t.Helper()
+	storage, err := NewStorage(filepath.Join(t.TempDir(), "apartments.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { storage.Close() })
+	return storage
+}
+
+func lifecycleState(t *testing.T, storage *Storage, id string) string {
+	t.Helper()
+	var state string
+	if err := storage.db.QueryRow(`SELECT lifecycle_state FROM seen_listings WHERE id = ?`, id).Scan(&state); err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func TestRecordAbsencesAcrossSearches(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+	const threshold = 2
+
+	// shared matches both searches; only is matched by search a alone
+	shared := Listing{ID: "1", Source: SourceStreetEasy, Street: "123 N 7th St", Price: 3000}
+	only := Listing{ID: "2", Source: SourceStreetEasy, Street: "45 Berry St", Price: 2800}
+	for _, seen := range []Listing{
+		withSearch(shared, "a"), withSearch(only, "a"), withSearch(shared, "b"),
+	} {
+		if err := storage.MarkSeen(ctx, seen); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Search a stops returning both; search b still returns shared
+	for poll := 1; poll <= threshold+1; poll++ {
+		changes, err := storage.RecordAbsences(ctx, SourceStreetEasy, "a", map[string]bool{}, threshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, change := range changes {
+			if change.ListingID != only.ID {
+				t.Errorf("poll %d: %s left the market while search b still returns it", poll, change.ListingID)
+			}
+		}
+		if _, err := storage.RecordAbsences(ctx, SourceStreetEasy, "b", map[string]bool{shared.ID: true}, threshold); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := lifecycleState(t, storage, shared.ID); got != LifecycleActive {
+		t.Errorf("shared listing is %s, want %s", got, LifecycleActive)
+	}
+	if got := lifecycleState(t, storage, only.ID); got != LifecycleDisappeared {
+		t.Errorf("listing only in search a is %s, want %s", got, LifecycleDisappeared)
+	}
+
+	// Once search b misses it too, it leaves after b's own threshold
+	for poll := 1; poll <= threshold; poll++ {
+		changes, err := storage.RecordAbsences(ctx, SourceStreetEasy, "b", map[string]bool{}, threshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if left := len(changes) > 0; left != (poll == threshold) {
+			t.Errorf("search b miss %d: changes = %v", poll, changes)
+		}
+	}
+	if got := lifecycleState(t, storage, shared.ID); got != LifecycleDisappeared {
+		t.Errorf("shared listing is %s, want %s", got, LifecycleDisappeared)
+	}
+}
+
+func TestForgetSearchesReleasesListings(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+
+	listing := Listing{ID: "1", Source: SourceStreetEasy, Street: "123 N 7th St", Price: 3000}
+	for _, name := range []string{"a", "removed"} {
+		if err := storage.MarkSeen(ctx, withSearch(listing, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A search that no longer runs would otherwise keep it active forever
+	if err := storage.ForgetSearches(ctx, []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := storage.RecordAbsences(ctx, SourceStreetEasy, "a", map[string]bool{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].ListingID != listing.ID {
+		t.Errorf("changes = %v, want listing %s off the market", changes, listing.ID)
+	}
+}
+
+func withSearch(listing Listing, search string) Listing {
+	listing.SearchName = search
+	return listing
+}
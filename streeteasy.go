@@ -2,197 +2,604 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
+	"math/rand"
 	"net/http"
+	"net/url"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 const (
-	streetEasyAPI     = "https://api-v6.streeteasy.com/"
-	apolloClientName  = "srp-frontend-service"
-	apolloVersion     = "version 28acce3818ba1c642a4e7f28710199fdbc967f37"
-	userAgent         = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/142.0.0.0 Safari/537.36"
+	streetEasyAPI    = "https://api-v6.streeteasy.com/"
+	apolloClientName = "srp-frontend-service"
+	apolloVersion    = "version 28acce3818ba1c642a4e7f28710199fdbc967f37"
+	userAgent        = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/142.0.0.0 Safari/537.36"
+
+	streetEasyPerPage   = 500
+	streetEasyMaxPages  = 10
+	streetEasyPageDelay = 2 * time.Second
+
+	streetEasyMaxAttempts  = 4
+	streetEasyRetryBase    = 2 * time.Second
+	streetEasyRetryMaxWait = 1 * time.Minute
+
+	// proxyBenchDuration is how long a proxy StreetEasy blocked is skipped
+	proxyBenchDuration = 30 * time.Minute
 )
 
+// rentalsQuery is the GraphQL query for rental searches
+const rentalsQuery = `
+  query GetListingRental($input: SearchRentalsInput!) {
+    searchRentals(input: $input) {
+      search {
+        criteria
+      }
+      totalCount
+      edges {
+        ... on OrganicRentalEdge {
+          node {
+            id
+            areaName
+            bedroomCount
+            buildingType
+            fullBathroomCount
+            geoPoint {
+              latitude
+              longitude
+            }
+            halfBathroomCount
+            leadMedia {
+              photo {
+                  key
+              }
+            }
+            price
+            relloExpress {
+              ctaEnabled
+              link
+              rentalId
+            }
+            sourceGroupLabel
+            status
+            street
+            unit
+            urlPath
+            tier
+          }
+        }
+      }
+    }
+  }
+`
+
+// salesQuery is the GraphQL query for sale searches
+const salesQuery = `
+  query GetListingSale($input: SearchSalesInput!) {
+    searchSales(input: $input) {
+      search {
+        criteria
+      }
+      totalCount
+      edges {
+        ... on OrganicSaleEdge {
+          node {
+            id
+            areaName
+            bedroomCount
+            buildingType
+            fullBathroomCount
+            geoPoint {
+              latitude
+              longitude
+            }
+            halfBathroomCount
+            leadMedia {
+              photo {
+                  key
+              }
+            }
+            price
+            maintenance
+            commonCharges
+            taxes
+            sourceGroupLabel
+            status
+            street
+            unit
+            urlPath
+            tier
+          }
+        }
+      }
+    }
+  }
+`
+
+// streetEasyNodeFields are the node fields requested by rentalsQuery and
+// salesQuery. Keep these in sync with the queries.
+var streetEasyNodeFields = map[ListingKind][]string{
+	ListingKindRental: {
+		"id", "areaName", "bedroomCount", "buildingType", "fullBathroomCount",
+		"geoPoint", "halfBathroomCount", "leadMedia", "price", "relloExpress",
+		"sourceGroupLabel", "status", "street", "unit", "urlPath", "tier",
+	},
+	ListingKindSale: {
+		"id", "areaName", "bedroomCount", "buildingType", "fullBathroomCount",
+		"geoPoint", "halfBathroomCount", "leadMedia", "price", "maintenance",
+		"commonCharges", "taxes", "sourceGroupLabel", "status", "street",
+		"unit", "urlPath", "tier",
+	},
+}
+
 // StreetEasyClient handles API requests to StreetEasy
 type StreetEasyClient struct {
-	httpClient *http.Client
+	httpClient   *http.Client
+	perPage      int
+	maxPages     int
+	pageDelay    time.Duration
+	maxAttempts  int
+	retryBase    time.Duration
+	retryMaxWait time.Duration
+
+	// thresholdMu guards shardThreshold, the totalCount above which a
+	// search is sharded up front. It starts at what we can page through and
+	// drops to the depth the API actually serves once a query runs dry early.
+	thresholdMu    sync.Mutex
+	shardThreshold int
+
+	// identityMu guards the proxies and profiles requests are sent with
+	identityMu sync.Mutex
+	proxies    []*url.URL
+	profiles   []headerProfile
+
+	// profile is used for every request when there are no proxies
+	profile headerProfile
+
+	// benchedUntil is when each proxy may be used again after a block
+	benchedUntil []time.Time
+	requestCount int
+
+	// detailMu guards lastDetailAt, which paces detail requests
+	detailMu     sync.Mutex
+	lastDetailAt time.Time
 }
 
-// NewStreetEasyClient creates a new StreetEasy API client
-func NewStreetEasyClient() *StreetEasyClient {
-	return &StreetEasyClient{
+// proxyContextKey carries the chosen proxy from a request to the transport
+type proxyContextKey struct{}
+
+// requestIdentity is the proxy and browser profile used for one request
+type requestIdentity struct {
+	proxy   *url.URL
+	profile headerProfile
+}
+
+// NewStreetEasyClient creates a new StreetEasy API client. Requests rotate
+// through the proxies, each with its own header profile; without proxies one
+// profile is picked for the life of the process. All bundled profiles are
+// used if none are given.
+func NewStreetEasyClient(proxies []*url.URL, profiles []headerProfile) *StreetEasyClient {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		if proxy, ok := req.Context().Value(proxyContextKey{}).(*url.URL); ok {
+			return proxy, nil
+		}
+		return http.ProxyFromEnvironment(req)
+	}
+
+	c := &StreetEasyClient{
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   30 * time.Second,
+			Transport: transport,
 		},
+		perPage:      streetEasyPerPage,
+		maxPages:     streetEasyMaxPages,
+		pageDelay:    streetEasyPageDelay,
+		maxAttempts:  streetEasyMaxAttempts,
+		retryBase:    streetEasyRetryBase,
+		retryMaxWait: streetEasyRetryMaxWait,
+		// Shard anything we couldn't page all the way through
+		shardThreshold: streetEasyPerPage * streetEasyMaxPages,
 	}
+	c.Reconfigure(proxies, profiles)
+	return c
 }
 
-// FetchListings fetches apartment listings from StreetEasy
-func (c *StreetEasyClient) FetchListings() ([]Listing, error) {
+// Reconfigure swaps in new proxies and header profiles. Requests already
+// running keep their identity. Proxies that stay configured stay benched,
+// and the no-proxy profile stays pinned unless it was dropped from the list.
+func (c *StreetEasyClient) Reconfigure(proxies []*url.URL, profiles []headerProfile) {
+	if len(profiles) == 0 {
+		profiles = headerProfiles
+	}
+
+	c.identityMu.Lock()
+	defer c.identityMu.Unlock()
+
+	benched := make([]time.Time, len(proxies))
+	for i, proxy := range proxies {
+		for j, old := range c.proxies {
+			if old.String() == proxy.String() {
+				benched[i] = c.benchedUntil[j]
+			}
+		}
+	}
+
+	c.proxies = proxies
+	c.profiles = profiles
+	c.benchedUntil = benched
+	c.requestCount = 0
+	if !containsProfile(profiles, c.profile.Name) {
+		c.profile = profiles[rand.Intn(len(profiles))]
+	}
+}
+
+// Name returns the source name
+func (c *StreetEasyClient) Name() string {
+	return SourceStreetEasy
+}
+
+// NodeFields returns the node fields requested by each query
+func (c *StreetEasyClient) NodeFields() map[ListingKind][]string {
+	return streetEasyNodeFields
+}
+
+// FetchListings fetches apartment listings from StreetEasy for a search.
+// Searches whose totalCount exceeds the shard threshold, or whose pages run
+// out before totalCount, are split into narrower shards which are fetched
+// separately and merged.
+func (c *StreetEasyClient) FetchListings(ctx context.Context, search Search) (*FetchResult, error) {
+	return c.fetchSharded(ctx, search, 0)
+}
+
+// fetchSharded fetches a search, recursively splitting it while it is too
+// broad, and deduplicates the merged shards by listing ID
+func (c *StreetEasyClient) fetchSharded(ctx context.Context, search Search, depth int) (*FetchResult, error) {
+	// Keep one search token across pages, like the website does
+	token := uuid.New().String()
+	first, err := c.fetchPage(ctx, search, 1, token)
+	if err != nil {
+		return nil, fmt.Errorf("page 1: %w", err)
+	}
+
+	// paged is set when the search was paged through before sharding
+	var paged *FetchResult
+	if first.TotalCount <= c.threshold() || depth >= maxShardDepth {
+		paged, err = c.fetchRemainingPages(ctx, search, token, first)
+		if err != nil || !paged.Truncated || depth >= maxShardDepth {
+			return paged, err
+		}
+	}
+
+	shards := splitSearch(search)
+	if len(shards) < 2 {
+		if paged != nil {
+			return paged, nil
+		}
+		return c.fetchRemainingPages(ctx, search, token, first)
+	}
+	if paged != nil {
+		log.Printf("Search %q (%s) stopped at %d of %d results, splitting into %d shards",
+			search.Name, describeShard(search), len(paged.Listings), first.TotalCount, len(shards))
+	} else {
+		log.Printf("Search %q (%s) has %d results, splitting into %d shards",
+			search.Name, describeShard(search), first.TotalCount, len(shards))
+	}
+
+	result := &FetchResult{TotalCount: first.TotalCount, Pages: 1}
+	seen := make(map[string]bool)
+	merge := func(listings []Listing) {
+		for _, listing := range listings {
+			if !seen[listing.ID] {
+				seen[listing.ID] = true
+				result.Listings = append(result.Listings, listing)
+			}
+		}
+	}
+	if paged != nil {
+		merge(paged.Listings)
+		result.Pages = paged.Pages
+	} else {
+		merge(c.toListings(search, first))
+	}
+
+	for _, shard := range shards {
+		// Be polite between shards
+		if err := sleepContext(ctx, c.pageDelay); err != nil {
+			return nil, err
+		}
+
+		shardResult, err := c.fetchSharded(ctx, shard, depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("shard %s: %w", describeShard(shard), err)
+		}
+		merge(shardResult.Listings)
+		result.Pages += shardResult.Pages
+		result.Shards += max(shardResult.Shards, 1)
+		result.Truncated = result.Truncated || shardResult.Truncated
+	}
+
+	return result, nil
+}
+
+// fetchRemainingPages walks pages after the first until totalCount results
+// are collected or the page cap is hit. A result that falls short of
+// totalCount, whether from the cap or from the API returning short pages, is
+// marked truncated.
+func (c *StreetEasyClient) fetchRemainingPages(ctx context.Context, search Search, token string, first *SearchRentalsResult) (*FetchResult, error) {
+	result := &FetchResult{
+		Listings:   c.toListings(search, first),
+		TotalCount: first.TotalCount,
+		Pages:      1,
+	}
+	seenEdges := len(first.Edges)
+	lastEdges := len(first.Edges)
+
+	for page := 2; ; page++ {
+		// Stop once everything is collected or the API runs dry
+		if seenEdges >= result.TotalCount || lastEdges < c.perPage {
+			break
+		}
+		if page > c.maxPages {
+			break
+		}
+
+		// Be polite between pages
+		if err := sleepContext(ctx, c.pageDelay); err != nil {
+			return nil, err
+		}
+
+		pageResult, err := c.fetchPage(ctx, search, page, token)
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %w", page, err)
+		}
+		result.Pages = page
+		result.Listings = append(result.Listings, c.toListings(search, pageResult)...)
+		seenEdges += len(pageResult.Edges)
+		lastEdges = len(pageResult.Edges)
+	}
+
+	if seenEdges < result.TotalCount {
+		result.Truncated = true
+
+		// Pages that run dry on a page boundary mean the API won't go any
+		// deeper, so shard broader searches before paging next time.
+		// Listings removed mid-search leave an odd count instead.
+		if lastEdges < c.perPage && seenEdges > 0 && seenEdges%c.perPage == 0 {
+			c.lowerThreshold(seenEdges)
+		}
+	}
+
+	return result, nil
+}
+
+// threshold returns the totalCount above which searches are sharded up front
+func (c *StreetEasyClient) threshold() int {
+	c.thresholdMu.Lock()
+	defer c.thresholdMu.Unlock()
+
+	return c.shardThreshold
+}
+
+// lowerThreshold drops the shard threshold to the deepest result count the
+// API served for one query
+func (c *StreetEasyClient) lowerThreshold(depth int) {
+	c.thresholdMu.Lock()
+	defer c.thresholdMu.Unlock()
+
+	if depth < c.shardThreshold {
+		log.Printf("StreetEasy stops serving results after %d per query; sharding broader searches up front", depth)
+		c.shardThreshold = depth
+	}
+}
+
+// toListings converts a page of results into listings tagged with the search
+func (c *StreetEasyClient) toListings(search Search, page *SearchRentalsResult) []Listing {
+	kind := ListingKindRental
+	if search.IsSale() {
+		kind = ListingKindSale
+	}
+
+	criteria := page.Search.CriteriaString()
+
+	var listings []Listing
+	for _, edge := range page.Edges {
+		if edge.Node != nil {
+			listing := edge.Node.ToListing()
+			listing.Kind = kind
+			listing.Source = SourceStreetEasy
+			listing.SearchName = search.Name
+			listing.SearchCriteria = criteria
+			listings = append(listings, listing)
+		}
+	}
+	return listings
+}
+
+// fetchPage fetches a single page of search results
+func (c *StreetEasyClient) fetchPage(ctx context.Context, search Search, page int, token string) (*SearchRentalsResult, error) {
 	// Build the request body
-	requestBody := c.buildRequestBody()
+	requestBody := c.buildRequestBody(search, page, token)
+
+	body, err := c.post(ctx, requestBody)
+	if err != nil {
+		return nil, err
+	}
 
+	// Parse the response
+	var graphQLResponse GraphQLResponse
+	if err := json.Unmarshal(body, &graphQLResponse); err != nil {
+		return nil, &SourceError{Category: ErrorCategoryBadResponse, Message: "failed to parse response", Err: err}
+	}
+
+	// Check for GraphQL errors
+	if len(graphQLResponse.Errors) > 0 {
+		return nil, &SourceError{Category: ErrorCategoryGraphQL, Message: graphQLResponse.Errors[0].Message}
+	}
+
+	// Check for nil data
+	if graphQLResponse.Data == nil {
+		return nil, &SourceError{Category: ErrorCategoryBadResponse, Message: "no data in response"}
+	}
+
+	if search.IsSale() {
+		return &graphQLResponse.Data.SearchSales, nil
+	}
+	return &graphQLResponse.Data.SearchRentals, nil
+}
+
+// post sends a GraphQL request body to StreetEasy and returns the raw
+// response, retrying transient failures with backoff
+func (c *StreetEasyClient) post(ctx context.Context, requestBody map[string]interface{}) ([]byte, error) {
 	jsonBody, err := json.Marshal(requestBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request body: %w", err)
 	}
 
+	var identity requestIdentity
+	attempt := func() ([]byte, error) {
+		identity = c.nextIdentity()
+		return c.postOnce(ctx, jsonBody, identity)
+	}
+
+	// Blocks are usually per IP, so bench the proxy and go straight to the
+	// next one; only when none are left is the source blocked
+	nextProxy := func(srcErr *SourceError) bool {
+		if srcErr.Category != ErrorCategoryBlocked || identity.proxy == nil || !c.benchProxy(identity.proxy) {
+			return false
+		}
+		log.Printf("StreetEasy blocked proxy %s, benching it for %s and retrying through the next one",
+			identity.proxy.Redacted(), proxyBenchDuration)
+		return true
+	}
+
+	return retryRequest(ctx, SourceStreetEasy, c.maxAttempts, c.retryBase, c.retryMaxWait, attempt, nextProxy)
+}
+
+// nextIdentity picks the proxy and header profile for the next request.
+// Without proxies every request uses the pinned profile, so our one IP
+// always looks like the same browser. Proxies rotate round-robin, skipping
+// benched ones, and each keeps the same profile. If every proxy is benched
+// the one due back soonest is used, so breaker probes still go out.
+func (c *StreetEasyClient) nextIdentity() requestIdentity {
+	c.identityMu.Lock()
+	defer c.identityMu.Unlock()
+
+	if len(c.proxies) == 0 {
+		return requestIdentity{profile: c.profile}
+	}
+
+	now := time.Now()
+	soonest := -1
+	for range c.proxies {
+		i := c.requestCount % len(c.proxies)
+		c.requestCount++
+		if !now.Before(c.benchedUntil[i]) {
+			return c.proxyIdentity(i)
+		}
+		if soonest < 0 || c.benchedUntil[i].Before(c.benchedUntil[soonest]) {
+			soonest = i
+		}
+	}
+	return c.proxyIdentity(soonest)
+}
+
+// proxyIdentity returns the identity for the proxy at index i
+func (c *StreetEasyClient) proxyIdentity(i int) requestIdentity {
+	return requestIdentity{
+		proxy:   c.proxies[i],
+		profile: c.profiles[i%len(c.profiles)],
+	}
+}
+
+// benchProxy skips a blocked proxy for proxyBenchDuration. It reports
+// whether another proxy is still usable.
+func (c *StreetEasyClient) benchProxy(proxy *url.URL) bool {
+	c.identityMu.Lock()
+	defer c.identityMu.Unlock()
+
+	now := time.Now()
+	usable := false
+	for i, p := range c.proxies {
+		// Compare by URL; Reconfigure may have swapped in freshly parsed ones
+		if p.String() == proxy.String() {
+			c.benchedUntil[i] = now.Add(proxyBenchDuration)
+		} else if !now.Before(c.benchedUntil[i]) {
+			usable = true
+		}
+	}
+	return usable
+}
+
+// postOnce makes a single request attempt with the given identity
+func (c *StreetEasyClient) postOnce(ctx context.Context, jsonBody []byte, identity requestIdentity) ([]byte, error) {
 	// Create the request
-	req, err := http.NewRequest("POST", streetEasyAPI, bytes.NewBuffer(jsonBody))
+	if identity.proxy != nil {
+		ctx = context.WithValue(ctx, proxyContextKey{}, identity.proxy)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", streetEasyAPI, bytes.NewBuffer(jsonBody))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set required headers (matching browser request)
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("User-Agent", userAgent)
 	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
 	req.Header.Set("Origin", "https://streeteasy.com")
 	req.Header.Set("Referer", "https://streeteasy.com/")
 	req.Header.Set("apollographql-client-name", apolloClientName)
 	req.Header.Set("apollographql-client-version", apolloVersion)
 	req.Header.Set("app-version", "1.0.0")
 	req.Header.Set("os", "web")
-	req.Header.Set("sec-ch-ua", `"Chromium";v="142", "Google Chrome";v="142", "Not_A Brand";v="99"`)
-	req.Header.Set("sec-ch-ua-mobile", "?0")
-	req.Header.Set("sec-ch-ua-platform", `"macOS"`)
 	req.Header.Set("Sec-Fetch-Site", "same-site")
 	req.Header.Set("Sec-Fetch-Mode", "cors")
 	req.Header.Set("Sec-Fetch-Dest", "empty")
+	identity.profile.apply(req.Header)
 
 	// Execute the request
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
+		return nil, &SourceError{Category: ErrorCategoryNetwork, Message: "failed to execute request", Err: err}
 	}
 	defer resp.Body.Close()
 
 	// Read the response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, &SourceError{Category: ErrorCategoryNetwork, Message: "failed to read response body", Err: err}
 	}
 
-	// Check for non-200 status
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
-	}
-
-	// Parse the response
-	var graphQLResponse GraphQLResponse
-	if err := json.Unmarshal(body, &graphQLResponse); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
-	}
-
-	// Check for GraphQL errors
-	if len(graphQLResponse.Errors) > 0 {
-		return nil, fmt.Errorf("GraphQL error: %s", graphQLResponse.Errors[0].Message)
-	}
-
-	// Check for nil data
-	if graphQLResponse.Data == nil {
-		return nil, fmt.Errorf("no data in response")
+	// Check for non-200 status or a block page served with 200
+	if resp.StatusCode != http.StatusOK || blockPageKind(resp, body) != "" {
+		return nil, statusError(SourceStreetEasy, resp, body)
 	}
 
-	// Convert to Listing slice
-	var listings []Listing
-	for _, edge := range graphQLResponse.Data.SearchRentals.Edges {
-		if edge.Node != nil {
-			listings = append(listings, edge.Node.ToListing())
-		}
-	}
-
-	return listings, nil
+	return body, nil
 }
 
-// buildRequestBody constructs the GraphQL request body
-func (c *StreetEasyClient) buildRequestBody() map[string]interface{} {
-	query := `
-  query GetListingRental($input: SearchRentalsInput!) {
-    searchRentals(input: $input) {
-      search {
-        criteria
-      }
-      totalCount
-      edges {
-        ... on OrganicRentalEdge {
-          node {
-            id
-            areaName
-            bedroomCount
-            buildingType
-            fullBathroomCount
-            geoPoint {
-              latitude
-              longitude
-            }
-            halfBathroomCount
-            leadMedia {
-              photo {
-                  key
-              }
-            }
-            price
-            relloExpress {
-              ctaEnabled
-              link
-              rentalId
-            }
-            sourceGroupLabel
-            status
-            street
-            unit
-            urlPath
-            tier
-          }
-        }
-      }
-    }
-  }
-`
+// buildRequestBody constructs the GraphQL request body for one page of a search
+func (c *StreetEasyClient) buildRequestBody(search Search, page int, token string) map[string]interface{} {
+	query := rentalsQuery
+	if search.IsSale() {
+		query = salesQuery
+	}
 
 	variables := map[string]interface{}{
 		"input": map[string]interface{}{
-			"filters": map[string]interface{}{
-				"rentalStatus": "ACTIVE",
-				"areas": []int{
-					104, 105, 106, 113, 115, 116, 117, 157, 158, 162,
-				},
-				"buildingType": []string{"RENTAL"},
-				"price": map[string]interface{}{
-					"lowerBound": 1750,
-					"upperBound": 9000,
-				},
-				"bedrooms": map[string]interface{}{
-					"lowerBound": 3,
-					"upperBound": 3,
-				},
-				"amenities": []string{"LAUNDRY", "PRIVATE_OUTDOOR_SPACE"},
-				"optionalAmenities": []string{"WASHER_DRYER"},
-				"boundingBox": map[string]interface{}{
-					"topLeft": map[string]interface{}{
-						"latitude":  40.774,
-						"longitude": -74.036,
-					},
-					"bottomRight": map[string]interface{}{
-						"latitude":  40.698,
-						"longitude": -73.926,
-					},
-				},
-			},
-			"page":            1,
-			"perPage":         500,
+			"filters": search.Filters(),
+			"page":    page,
+			"perPage": c.perPage,
 			"sorting": map[string]interface{}{
 				"attribute": "RECOMMENDED",
 				"direction": "DESCENDING",
 			},
-			"userSearchToken": uuid.New().String(),
+			"userSearchToken": token,
 			"adStrategy":      "NONE",
 		},
 	}